@@ -0,0 +1,193 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LocalACL is the ACL holding the permissions set on the document itself
+	LocalACL = "local"
+)
+
+// ACP is the access control policy of a document, its ACLs ordered by precedence
+type ACP struct {
+	EntityType string `json:"entity-type"`
+	ACLs       []ACL  `json:"acl"`
+}
+
+// ACL is a named list of access control entries
+type ACL struct {
+	Name string `json:"name"`
+	ACEs []ACE  `json:"ace"`
+}
+
+// ACE grants or denies a permission to a user or a group
+type ACE struct {
+	ID         string     `json:"id"`
+	Username   string     `json:"username"`
+	Permission string     `json:"permission"`
+	Granted    bool       `json:"granted"`
+	Creator    string     `json:"creator"`
+	Begin      *time.Time `json:"begin"`
+	End        *time.Time `json:"end"`
+	Status     string     `json:"status"`
+}
+
+// Permission describes a permission to add to a document
+type Permission struct {
+	// Users are user or group names
+	Users      []string
+	Permission string
+	// ACL is LocalACL when empty
+	ACL              string
+	Begin            *time.Time
+	End              *time.Time
+	BlockInheritance bool
+	Notify           bool
+	Comment          string
+}
+
+// FetchACP returns the ACLs of the document
+func (doc Document) FetchACP(ctx context.Context) (ACP, error) {
+	if err := doc.bound(); err != nil {
+		return ACP{}, err
+	}
+
+	url := doc.nuxeoClient.documentURL(doc) + "/@acl"
+
+	resp, err := doc.nuxeoClient.request(ctx).Get(url)
+
+	var acp ACP
+	err = HandleResponse(err, resp, &acp)
+
+	return acp, err
+}
+
+// AddPermission adds an ACE for each of the permission users
+func (doc Document) AddPermission(ctx context.Context, permission Permission) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	params := map[string]string{
+		"users":            strings.Join(permission.Users, ","),
+		"permission":       permission.Permission,
+		"acl":              aclName(permission.ACL),
+		"blockInheritance": strconv.FormatBool(permission.BlockInheritance),
+		"notify":           strconv.FormatBool(permission.Notify),
+	}
+	if permission.Begin != nil {
+		params["begin"] = permission.Begin.Format(time.RFC3339)
+	}
+	if permission.End != nil {
+		params["end"] = permission.End.Format(time.RFC3339)
+	}
+	if permission.Comment != "" {
+		params["comment"] = permission.Comment
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.AddPermission").Input(doc.input()).Parameters(params).DocExecute(ctx)
+}
+
+// RemovePermission removes the ACE with the given id from acl (LocalACL when empty)
+func (doc Document) RemovePermission(ctx context.Context, aceID string, acl string) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	params := map[string]string{
+		"id":  aceID,
+		"acl": aclName(acl),
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.RemovePermission").Input(doc.input()).Parameters(params).DocExecute(ctx)
+}
+
+// BlockPermissionInheritance stops the document from inheriting the permissions of its parents
+func (doc Document) BlockPermissionInheritance(ctx context.Context) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	params := map[string]string{
+		"acl": LocalACL,
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.BlockPermissionInheritance").Input(doc.input()).Parameters(params).DocExecute(ctx)
+}
+
+// UnblockPermissionInheritance restores the inheritance of the permissions of its parents
+func (doc Document) UnblockPermissionInheritance(ctx context.Context) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	params := map[string]string{
+		"acl": LocalACL,
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.UnblockPermissionInheritance").Input(doc.input()).Parameters(params).DocExecute(ctx)
+}
+
+// FetchPermissions returns the effective permissions of the authenticated user on the document,
+// computed by the permissions enricher
+func (doc Document) FetchPermissions(ctx context.Context) ([]string, error) {
+	if err := doc.bound(); err != nil {
+		return nil, err
+	}
+
+	enriched, err := doc.fetchEnriched(ctx, "permissions")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions []string
+	err = enriched.ContextParameter("permissions", &permissions)
+
+	return permissions, err
+}
+
+// HasPermission reports whether the authenticated user has permission on the document
+func (doc Document) HasPermission(ctx context.Context, permission string) (bool, error) {
+	permissions, err := doc.FetchPermissions(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, granted := range permissions {
+		if granted == permission {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func aclName(acl string) string {
+	if acl == "" {
+		return LocalACL
+	}
+	return acl
+}
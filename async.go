@@ -0,0 +1,128 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+)
+
+const (
+	// DefaultAsyncConcurrency is the number of async calls running at the same time if none has been set
+	DefaultAsyncConcurrency = 8
+)
+
+// future holds the result of a call running in the background
+type future struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// DocumentFuture is the pending result of an async document call
+type DocumentFuture struct {
+	*future
+}
+
+// DocumentsFuture is the pending result of an async query
+type DocumentsFuture struct {
+	*future
+}
+
+// BlobFuture is the pending result of an async blob download
+type BlobFuture struct {
+	*future
+}
+
+// failedFuture is a future already resolved with err
+func failedFuture(err error) *future {
+	f := &future{done: make(chan struct{})}
+	f.resolve(nil, err)
+	return f
+}
+
+func (f *future) resolve(value interface{}, err error) {
+	f.value = value
+	f.err = err
+	close(f.done)
+}
+
+func (f *future) await(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done is closed once the result is available
+func (f *future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await waits for the document or for ctx to be done
+func (f DocumentFuture) Await(ctx context.Context) (Document, error) {
+	value, err := f.await(ctx)
+	doc, _ := value.(Document)
+	return doc, err
+}
+
+// Await waits for the query result or for ctx to be done
+func (f DocumentsFuture) Await(ctx context.Context) (Documents, error) {
+	value, err := f.await(ctx)
+	records, _ := value.(Documents)
+	return records, err
+}
+
+// Await waits for the blob or for ctx to be done
+func (f BlobFuture) Await(ctx context.Context) ([]byte, error) {
+	value, err := f.await(ctx)
+	blob, _ := value.([]byte)
+	return blob, err
+}
+
+// background runs call in its own goroutine, outside of the slots bounding the async calls
+func background(call func() (interface{}, error)) *future {
+	f := &future{done: make(chan struct{})}
+
+	go func() {
+		f.resolve(call())
+	}()
+
+	return f
+}
+
+// async runs call in the background once a slot is free, so that no more than
+// the configured number of calls are in flight for this client
+func (nuxeoClient *nuxeoClient) async(ctx context.Context, call func() (interface{}, error)) *future {
+	f := &future{done: make(chan struct{})}
+
+	select {
+	case nuxeoClient.slots <- struct{}{}:
+	case <-ctx.Done():
+		f.resolve(nil, ctx.Err())
+		return f
+	}
+
+	go func() {
+		defer func() { <-nuxeoClient.slots }()
+		f.resolve(call())
+	}()
+
+	return f
+}
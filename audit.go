@@ -0,0 +1,219 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogEntry is an audit entry, such as a document creation or modification
+type LogEntry struct {
+	ID            int64                  `json:"id"`
+	EventID       string                 `json:"eventId"`
+	Category      string                 `json:"category"`
+	PrincipalName string                 `json:"principalName"`
+	Comment       string                 `json:"comment"`
+	DocUUID       string                 `json:"docUUID"`
+	DocPath       string                 `json:"docPath"`
+	DocType       string                 `json:"docType"`
+	DocLifeCycle  string                 `json:"docLifeCycle"`
+	RepositoryID  string                 `json:"repositoryId"`
+	EventDate     time.Time              `json:"eventDate"`
+	LogDate       time.Time              `json:"logDate"`
+	Extended      map[string]interface{} `json:"extended"`
+}
+
+// LogEntries represents a page of audit entries
+type LogEntries struct {
+	Entries             []LogEntry `json:"entries"`
+	CurrentPageIndex    int        `json:"currentPageIndex"`
+	PageSize            int        `json:"pageSize"`
+	IsNextPageAvailable bool       `json:"isNextPageAvailable"`
+}
+
+// AuditOptions filters the audit entries, empty fields not filtering
+type AuditOptions struct {
+	EventIDs   []string
+	Principals []string
+	Categories []string
+	// Start and End bound the event date, the document audit only taking their UTC day into account
+	Start    time.Time
+	End      time.Time
+	PageSize int
+}
+
+// auditPageFetcher fetches one page of audit entries
+type auditPageFetcher func(ctx context.Context, pageSize int, currentPageIndex int) (LogEntries, error)
+
+// AuditIterator walks audit entries one by one, fetching the pages as needed.
+// It is not safe for concurrent use.
+type AuditIterator struct {
+	pager
+	fetch   auditPageFetcher
+	page    LogEntries
+	current LogEntry
+}
+
+func newAuditIterator(pageSize int, fetch auditPageFetcher) *AuditIterator {
+	return &AuditIterator{
+		pager: newPager(pageSize),
+		fetch: fetch,
+	}
+}
+
+// Next moves to the next entry, returning false once all pages have been read or on error
+func (it *AuditIterator) Next(ctx context.Context) bool {
+	position, ok := it.next(ctx, func(ctx context.Context, pageIndex int) (int, bool, error) {
+		page, err := it.fetch(ctx, it.pageSize, pageIndex)
+		if err != nil {
+			return 0, false, err
+		}
+		it.page = page
+		return len(page.Entries), page.IsNextPageAvailable, nil
+	})
+	if !ok {
+		return false
+	}
+
+	it.current = it.page.Entries[position]
+
+	return true
+}
+
+// Entry returns the current entry
+func (it *AuditIterator) Entry() LogEntry {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *AuditIterator) Err() error {
+	return it.err
+}
+
+// Audit walks the audit entries of the document through the @audit adapter, most recent first
+func (doc Document) Audit(options AuditOptions) *AuditIterator {
+	if err := doc.bound(); err != nil {
+		return &AuditIterator{pager: pager{err: err}}
+	}
+
+	return newAuditIterator(options.PageSize, func(ctx context.Context, pageSize int, currentPageIndex int) (LogEntries, error) {
+		request := doc.nuxeoClient.request(ctx).SetQueryParams(map[string]string{
+			"pageSize":         strconv.Itoa(pageSize),
+			"currentPageIndex": strconv.Itoa(currentPageIndex),
+		})
+		params := request.QueryParam
+		for _, eventID := range options.EventIDs {
+			params.Add("eventId", eventID)
+		}
+		for _, principal := range options.Principals {
+			params.Add("principalName", principal)
+		}
+		for _, category := range options.Categories {
+			params.Add("category", category)
+		}
+		if !options.Start.IsZero() {
+			params.Set("startEventDate", options.Start.UTC().Format("2006-01-02"))
+		}
+		if !options.End.IsZero() {
+			params.Set("endEventDate", options.End.UTC().Format("2006-01-02"))
+		}
+
+		resp, err := request.Get(doc.nuxeoClient.documentURL(doc) + "/@audit")
+
+		var entries LogEntries
+		err = HandleResponse(err, resp, &entries)
+
+		return entries, err
+	})
+}
+
+// AuditQuery walks the audit entries of the whole repository through the Audit.Query operation, most recent first
+func (nuxeoClient *nuxeoClient) AuditQuery(options AuditOptions) *AuditIterator {
+	query := auditQuery(options)
+
+	return newAuditIterator(options.PageSize, func(ctx context.Context, pageSize int, currentPageIndex int) (LogEntries, error) {
+		params := map[string]string{
+			"query":      query,
+			"pageNo":     strconv.Itoa(currentPageIndex + 1),
+			"maxResults": strconv.Itoa(pageSize),
+		}
+
+		data, err := nuxeoClient.Automation().Operation("Audit.Query").Parameters(params).BlobExecute(ctx)
+
+		if err != nil {
+			return LogEntries{}, err
+		}
+
+		entries := LogEntries{
+			CurrentPageIndex: currentPageIndex,
+			PageSize:         pageSize,
+		}
+		if err := json.Unmarshal(data, &entries.Entries); err != nil {
+			return LogEntries{}, err
+		}
+		// The operation does not tell the total size, a full page may be followed by others
+		entries.IsNextPageAvailable = len(entries.Entries) == pageSize
+
+		return entries, nil
+	})
+}
+
+// auditQuery builds the audit query of the options
+func auditQuery(options AuditOptions) string {
+	var conditions []string
+
+	if len(options.EventIDs) > 0 {
+		conditions = append(conditions, "log.eventId IN ("+auditStrings(options.EventIDs)+")")
+	}
+	if len(options.Principals) > 0 {
+		conditions = append(conditions, "log.principalName IN ("+auditStrings(options.Principals)+")")
+	}
+	if len(options.Categories) > 0 {
+		conditions = append(conditions, "log.category IN ("+auditStrings(options.Categories)+")")
+	}
+	if !options.Start.IsZero() {
+		conditions = append(conditions, "log.eventDate >= "+auditString(options.Start.UTC().Format("2006-01-02 15:04:05")))
+	}
+	if !options.End.IsZero() {
+		conditions = append(conditions, "log.eventDate < "+auditString(options.End.UTC().Format("2006-01-02 15:04:05")))
+	}
+
+	query := "FROM LogEntry log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return query + " ORDER BY log.eventDate DESC, log.id DESC"
+}
+
+func auditStrings(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = auditString(value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// auditString quotes a string literal of the audit query language, where quotes are doubled
+func auditString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
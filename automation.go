@@ -18,10 +18,12 @@
 package nuxeoclient
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/url"
+	"strconv"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -32,8 +34,10 @@ type automation struct {
 	context       map[string]string
 	input         string
 	nuxeoClient   *nuxeoClient
-	blob          []byte
-	blobName      string
+	blob          *blobPart
+	batch         *Batch
+	batchFileIdx  int
+	headers       map[string]string
 }
 
 type opBody struct {
@@ -48,11 +52,14 @@ type Automation interface {
 	Parameters(parameters map[string]string) Automation
 	Input(input string) Automation
 	Blob(string, []byte) Automation
+	BlobStream(name string, contentType string, reader io.Reader) Automation
+	BatchInput(batch *Batch, fileIdx int) Automation
+	Headers(headers map[string]string) Automation
 	Context(context map[string]string) Automation
-	Execute() (*resty.Response, error)
-	DocExecute() (document, error)
-	DocListExecute() (recordSet, error)
-	BlobExecute() ([]byte, error)
+	Execute(ctx context.Context) (*resty.Response, error)
+	DocExecute(ctx context.Context) (Document, error)
+	DocListExecute(ctx context.Context) (Documents, error)
+	BlobExecute(ctx context.Context) ([]byte, error)
 }
 
 // Operation name setter
@@ -63,12 +70,36 @@ func (auto *automation) Operation(name string) Automation {
 
 // Blob setter
 func (auto *automation) Blob(name string, blob []byte) Automation {
-	auto.blobName = name
-	auto.blob = blob
+	part := newBlobPart(name, blob)
+	auto.blob = &part
 	auto.input = name
 	return auto
 }
 
+// BlobStream setter, the blob is streamed from reader when the operation is executed
+func (auto *automation) BlobStream(name string, contentType string, reader io.Reader) Automation {
+	auto.blob = &blobPart{
+		name:        name,
+		contentType: contentType,
+		reader:      reader,
+	}
+	auto.input = name
+	return auto
+}
+
+// BatchInput sets the fileIdx file of the batch as input, or the whole batch with AllBatchFiles
+func (auto *automation) BatchInput(batch *Batch, fileIdx int) Automation {
+	auto.batch = batch
+	auto.batchFileIdx = fileIdx
+	return auto
+}
+
+// Headers setter, such as enrichers or fetch headers
+func (auto *automation) Headers(headers map[string]string) Automation {
+	auto.headers = headers
+	return auto
+}
+
 // Context setter
 func (auto *automation) Context(context map[string]string) Automation {
 	auto.context = context
@@ -88,82 +119,84 @@ func (auto *automation) Input(input string) Automation {
 }
 
 // Execute returns one of the Automation output type
-func (auto *automation) Execute() (*resty.Response, error) {
-	baseURL, err := url.Parse(auto.nuxeoClient.url)
-
-	_ = err
-
+func (auto *automation) Execute(ctx context.Context) (*resty.Response, error) {
 	if auto.operationName == "" {
-		return nil, errors.New("You should set an operation name")
+		return nil, errors.New("nuxeo: no operation name set")
 	}
 
 	if auto.context == nil {
 		auto.context = make(map[string]string)
 	}
 
-	baseURL.Path += "/site/automation/" + auto.operationName
+	var operationURL string
+	if auto.batch == nil {
+		operationURL = auto.nuxeoClient.url + "/site/automation/" + url.PathEscape(auto.operationName)
+	} else if auto.batchFileIdx == AllBatchFiles {
+		operationURL = auto.nuxeoClient.url + "/api/v1/upload/" + url.PathEscape(auto.batch.BatchID) + "/execute/" + url.PathEscape(auto.operationName)
+	} else {
+		operationURL = auto.nuxeoClient.url + "/api/v1/upload/" + url.PathEscape(auto.batch.BatchID) + "/" + strconv.Itoa(auto.batchFileIdx) + "/execute/" + url.PathEscape(auto.operationName)
+	}
 
 	opBody := &opBody{
 		Context: auto.context,
 		Params:  auto.parameters,
 	}
 
-	var body []byte
-
-	client := auto.nuxeoClient.client.R()
-	body, err = json.Marshal(opBody)
+	client := auto.nuxeoClient.request(ctx).SetHeaders(auto.headers)
+	body, err := json.Marshal(opBody)
+	if err != nil {
+		return nil, err
+	}
 
-	if auto.blobName != "" {
-		client.SetFileReader("operation_body", "operation_body", bytes.NewReader(body))
-		client.SetFileReader(auto.blobName, auto.blobName, bytes.NewReader(auto.blob))
-		client.SetHeader("Content-Type", "multipart/related")
+	if auto.blob != nil {
+		multipartBody, contentType := streamMultipart(body, *auto.blob)
+		defer multipartBody.Close()
+		client.SetBody(multipartBody)
+		client.SetHeader("Content-Type", contentType)
 	} else {
 		client.SetBody(string(body[:]))
 	}
 
-	response, err := client.EnableTrace().Post(baseURL.String())
+	response, err := client.Post(operationURL)
 
-	return response, err
+	return response, checkResponse(err, response)
 }
 
 // DocExecute returns doc from operation rest api
-func (auto *automation) DocExecute() (document, error) {
-	response, err := auto.Execute()
+func (auto *automation) DocExecute(ctx context.Context) (Document, error) {
+	response, err := auto.Execute(ctx)
 
 	if err != nil {
-		return document{}, err
+		return Document{}, err
 	}
 
-	var currentDoc document
+	var currentDoc Document
 	err = HandleResponse(err, response, &currentDoc)
 
-	currentDoc.nuxeoClient = *auto.nuxeoClient
+	currentDoc.nuxeoClient = auto.nuxeoClient
 
 	return currentDoc, err
 }
 
 // DocListExecute returns doc list from operation rest api
-func (auto *automation) DocListExecute() (recordSet, error) {
-	response, err := auto.Execute()
+func (auto *automation) DocListExecute(ctx context.Context) (Documents, error) {
+	response, err := auto.Execute(ctx)
 
 	if err != nil {
-		return recordSet{}, err
+		return Documents{}, err
 	}
 
-	var records recordSet
+	var records Documents
 	err = HandleResponse(err, response, &records)
 
-	for key, entry := range records.Documents {
-		_ = key
-		entry.nuxeoClient = *auto.nuxeoClient
-	}
+	records.attach(auto.nuxeoClient)
 
 	return records, err
 }
 
 // BlobExecute returns blob from operation rest api
-func (auto *automation) BlobExecute() ([]byte, error) {
-	response, err := auto.Execute()
+func (auto *automation) BlobExecute(ctx context.Context) ([]byte, error) {
+	response, err := auto.Execute(ctx)
 
 	if err != nil {
 		return nil, err
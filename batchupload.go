@@ -0,0 +1,208 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// DefaultChunkSize is the chunk size used by UploadChunked if none has been set
+	DefaultChunkSize = 5 * 1024 * 1024
+	// AllBatchFiles selects the whole batch as automation input
+	AllBatchFiles = -1
+)
+
+// Batch is a Nuxeo upload batch
+type Batch struct {
+	BatchID     string `json:"batchId"`
+	nuxeoClient *nuxeoClient
+}
+
+// BatchFile describes a file uploaded in a batch
+type BatchFile struct {
+	Name             string `json:"name"`
+	Size             int64  `json:"size"`
+	UploadType       string `json:"uploadType"`
+	UploadedChunkIDs []int  `json:"uploadedChunkIds"`
+	ChunkCount       int    `json:"chunkCount"`
+}
+
+// BatchBlob references a batch file from a document property, set it as a property value
+// before calling CreateDocument or UpdateDocument
+type BatchBlob struct {
+	BatchID string `json:"upload-batch"`
+	FileIdx string `json:"upload-fileId"`
+}
+
+// BatchUpload creates a new upload batch
+func (nuxeoClient *nuxeoClient) BatchUpload(ctx context.Context) (*Batch, error) {
+	uri := nuxeoClient.url + "/api/v1/upload"
+
+	resp, err := nuxeoClient.request(ctx).Post(uri)
+
+	batch := &Batch{nuxeoClient: nuxeoClient}
+	err = HandleResponse(err, resp, batch)
+
+	return batch, err
+}
+
+// Batch returns an existing upload batch, to resume an upload
+func (nuxeoClient *nuxeoClient) Batch(batchID string) *Batch {
+	return &Batch{
+		BatchID:     batchID,
+		nuxeoClient: nuxeoClient,
+	}
+}
+
+func (batch *Batch) url() string {
+	return batch.nuxeoClient.url + "/api/v1/upload/" + url.PathEscape(batch.BatchID)
+}
+
+func (batch *Batch) fileURL(fileIdx int) string {
+	return batch.url() + "/" + strconv.Itoa(fileIdx)
+}
+
+// Upload sends the whole file read from reader as the fileIdx file of the batch
+func (batch *Batch) Upload(ctx context.Context, fileIdx int, name string, contentType string, reader io.Reader, size int64) (BatchFile, error) {
+	resp, err := batch.nuxeoClient.request(ctx).
+		SetHeaders(fileHeaders(name, contentType, size)).
+		SetHeader("X-Upload-Type", "normal").
+		SetBody(reader).
+		Post(batch.fileURL(fileIdx))
+
+	err = HandleResponse(err, resp, nil)
+
+	return BatchFile{
+		Name:       name,
+		Size:       size,
+		UploadType: "normal",
+	}, err
+}
+
+// UploadChunked sends the file chunk by chunk (DefaultChunkSize if chunkSize <= 0).
+// Chunks already received by the server are skipped, so calling it again after a
+// failure resumes the upload.
+func (batch *Batch) UploadChunked(ctx context.Context, fileIdx int, name string, contentType string, reader io.ReaderAt, size int64, chunkSize int64) (BatchFile, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	chunkCount := int((size + chunkSize - 1) / chunkSize)
+	if chunkCount == 0 {
+		chunkCount = 1
+	}
+
+	uploaded := make(map[int]bool)
+
+	file, err := batch.File(ctx, fileIdx)
+	if err != nil && !IsNotFound(err) {
+		return BatchFile{}, err
+	}
+	for _, chunkID := range file.UploadedChunkIDs {
+		uploaded[chunkID] = true
+	}
+
+	// Chunks are sent as bytes, and the same chunk can be sent twice, so they can be retried
+	var buffer []byte
+
+	for chunk := 0; chunk < chunkCount; chunk++ {
+		if uploaded[chunk] {
+			continue
+		}
+
+		offset := int64(chunk) * chunkSize
+		length := chunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		// The first chunk sent is the largest one
+		if buffer == nil {
+			buffer = make([]byte, length)
+		}
+		data := buffer[:length]
+		if n, err := reader.ReadAt(data, offset); n < len(data) {
+			return BatchFile{}, err
+		}
+
+		resp, err := batch.nuxeoClient.request(retryable(ctx)).
+			SetHeaders(fileHeaders(name, contentType, size)).
+			SetHeaders(map[string]string{
+				"X-Upload-Type":        "chunked",
+				"X-Upload-Chunk-Index": strconv.Itoa(chunk),
+				"X-Upload-Chunk-Count": strconv.Itoa(chunkCount),
+			}).
+			SetBody(data).
+			Post(batch.fileURL(fileIdx))
+
+		if err = HandleResponse(err, resp, nil); err != nil {
+			return BatchFile{}, err
+		}
+	}
+
+	return batch.File(ctx, fileIdx)
+}
+
+// File returns the upload state of the fileIdx file of the batch
+func (batch *Batch) File(ctx context.Context, fileIdx int) (BatchFile, error) {
+	resp, err := batch.nuxeoClient.request(ctx).Get(batch.fileURL(fileIdx))
+
+	var file BatchFile
+	err = HandleResponse(err, resp, &file)
+
+	return file, err
+}
+
+// Files lists the files uploaded in the batch
+func (batch *Batch) Files(ctx context.Context) ([]BatchFile, error) {
+	resp, err := batch.nuxeoClient.request(ctx).Get(batch.url())
+
+	// An empty batch is answered with no content
+	files := []BatchFile{}
+	err = HandleResponse(err, resp, &files)
+
+	return files, err
+}
+
+// Delete drops the batch and its files
+func (batch *Batch) Delete(ctx context.Context) error {
+	resp, err := batch.nuxeoClient.request(ctx).Delete(batch.url())
+
+	return HandleResponse(err, resp, nil)
+}
+
+// Blob references the fileIdx file of the batch, to be set as a document property value
+func (batch *Batch) Blob(fileIdx int) BatchBlob {
+	return BatchBlob{
+		BatchID: batch.BatchID,
+		FileIdx: strconv.Itoa(fileIdx),
+	}
+}
+
+func fileHeaders(name string, contentType string, size int64) map[string]string {
+	return map[string]string{
+		"Content-Type": "application/octet-stream",
+		"X-File-Name":  url.QueryEscape(name),
+		"X-File-Type":  contentType,
+		"X-File-Size":  strconv.FormatInt(size, 10),
+	}
+}
@@ -0,0 +1,179 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// BlobInfo describes a downloaded blob
+type BlobInfo struct {
+	Filename    string
+	ContentType string
+	// Length is -1 when the server did not send it
+	Length int64
+	Digest string
+}
+
+// Blob is a blob streamed from the server, it must be closed once read
+type Blob struct {
+	BlobInfo
+	io.ReadCloser
+}
+
+// OpenBlob opens the blob stored at xpath without loading it in memory
+func (doc Document) OpenBlob(ctx context.Context, xpath string) (*Blob, error) {
+	if err := doc.bound(); err != nil {
+		return nil, err
+	}
+
+	url := doc.nuxeoClient.documentURL(doc) + "/@blob/" + escapePath(xpath)
+
+	resp, err := doc.nuxeoClient.request(ctx).SetDoNotParseResponse(true).Get(url)
+
+	if err != nil {
+		// resty returns no response when the request could not be sent
+		if resp != nil && resp.RawBody() != nil {
+			resp.RawBody().Close()
+		}
+		return nil, err
+	}
+
+	traceResponse(resp)
+
+	body := resp.RawBody()
+
+	if resp.IsError() {
+		data, _ := ioutil.ReadAll(body)
+		body.Close()
+		return nil, newNuxeoError(resp, data)
+	}
+
+	return &Blob{
+		BlobInfo:   newBlobInfo(resp),
+		ReadCloser: body,
+	}, nil
+}
+
+// FetchBlobTo streams the blob stored at xpath into w
+func (doc Document) FetchBlobTo(ctx context.Context, xpath string, w io.Writer) (BlobInfo, error) {
+	blob, err := doc.OpenBlob(ctx, xpath)
+
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	defer blob.Close()
+
+	_, err = io.Copy(w, blob)
+
+	return blob.BlobInfo, err
+}
+
+// newBlobInfo reads the blob metadata from the response headers
+func newBlobInfo(resp *resty.Response) BlobInfo {
+	header := resp.Header()
+
+	info := BlobInfo{
+		ContentType: header.Get("Content-Type"),
+		Length:      resp.RawResponse.ContentLength,
+	}
+
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		info.Filename = params["filename"]
+	}
+
+	info.Digest = header.Get("Digest")
+	if info.Digest == "" {
+		info.Digest = strings.Trim(strings.TrimPrefix(header.Get("ETag"), "W/"), `"`)
+	}
+
+	return info
+}
+
+// blobPart is a blob to upload, read as it is sent
+type blobPart struct {
+	name        string
+	contentType string
+	reader      io.Reader
+}
+
+// newBlobPart builds a part from an in-memory blob, sniffing its content type
+func newBlobPart(name string, blob []byte) blobPart {
+	return blobPart{
+		name:        name,
+		contentType: http.DetectContentType(blob),
+		reader:      bytes.NewReader(blob),
+	}
+}
+
+// streamMultipart returns the multipart body holding the operation body and the blob,
+// written as the request reads it so that the blob is never buffered
+func streamMultipart(body []byte, blob blobPart) (io.ReadCloser, string) {
+	reader, pipe := io.Pipe()
+	writer := multipart.NewWriter(pipe)
+
+	go func() {
+		pipe.CloseWithError(writeMultipart(writer, body, blob))
+	}()
+
+	return reader, writer.FormDataContentType()
+}
+
+func writeMultipart(writer *multipart.Writer, body []byte, blob blobPart) error {
+	part, err := writer.CreatePart(partHeader("operation_body", "application/json"))
+	if err != nil {
+		return err
+	}
+
+	if _, err = part.Write(body); err != nil {
+		return err
+	}
+
+	part, err = writer.CreatePart(partHeader(blob.name, blob.contentType))
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(part, blob.reader); err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+func partHeader(name string, contentType string) textproto.MIMEHeader {
+	quoted := strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(name)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoted, quoted))
+	header.Set("Content-Type", contentType)
+
+	return header
+}
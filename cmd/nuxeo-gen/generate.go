@@ -0,0 +1,209 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	nuxeoclient "github.com/vpasquier/nuxeo-go-client"
+)
+
+// scalarTypes maps the Nuxeo scalar types to Go types
+var scalarTypes = map[string]string{
+	"string":  "string",
+	"integer": "int64",
+	"long":    "int64",
+	"double":  "float64",
+	"boolean": "bool",
+	"date":    "time.Time",
+	"blob":    "nuxeoclient.BlobProperty",
+}
+
+type generator struct {
+	registry registry
+	buf      bytes.Buffer
+	// complexTypes are generated after the schemas using them
+	complexTypes bytes.Buffer
+	usesTime     bool
+}
+
+// generate returns the formatted source of the given document types, all of them when names is empty
+func generate(pkg string, reg registry, names []string) ([]byte, error) {
+	if len(names) == 0 {
+		for name := range reg.DocTypes {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	g := &generator{registry: reg}
+
+	schemas := make(map[string]bool)
+	for _, name := range names {
+		docType, ok := reg.DocTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown document type %s", name)
+		}
+		for _, ref := range docType.Schemas {
+			if _, ok := reg.Schemas[ref]; !ok {
+				return nil, fmt.Errorf("unknown schema %s of document type %s", ref, name)
+			}
+			schemas[ref] = true
+		}
+		g.docType(name, docType)
+	}
+
+	schemaNames := make([]string, 0, len(schemas))
+	for name := range schemas {
+		schemaNames = append(schemaNames, name)
+	}
+	sort.Strings(schemaNames)
+
+	for _, name := range schemaNames {
+		g.schema(reg.Schemas[name])
+	}
+
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "// Code generated by nuxeo-gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	if g.usesTime {
+		fmt.Fprintf(&header, "\t\"time\"\n\n")
+	}
+	fmt.Fprintf(&header, "\tnuxeoclient \"github.com/vpasquier/nuxeo-go-client\"\n)\n\n")
+	fmt.Fprintf(&header, "// DocumentMeta holds the metadata of the generated document types\n")
+	fmt.Fprintf(&header, "type DocumentMeta struct {\n")
+	fmt.Fprintf(&header, "UID string `nuxeo:\"%s,omitempty\"`\n", "ecm:uuid")
+	fmt.Fprintf(&header, "Name string `nuxeo:\"%s,omitempty\"`\n", "ecm:name")
+	fmt.Fprintf(&header, "Path string `nuxeo:\"%s,omitempty\"`\n", "ecm:path")
+	fmt.Fprintf(&header, "ChangeToken string `nuxeo:\"%s,omitempty\"`\n}\n\n", "ecm:changeToken")
+
+	header.Write(g.buf.Bytes())
+	header.Write(g.complexTypes.Bytes())
+
+	return format.Source(header.Bytes())
+}
+
+func (g *generator) docType(name string, docType nuxeoclient.DocType) {
+	typeName := identifier(name)
+
+	fmt.Fprintf(&g.buf, "// %sType is the name of the %s document type\n", typeName, name)
+	fmt.Fprintf(&g.buf, "const %sType = %q\n\n", typeName, name)
+
+	fmt.Fprintf(&g.buf, "// %s is the %s document type", typeName, name)
+	if docType.Parent != "" {
+		fmt.Fprintf(&g.buf, ", extending %s", docType.Parent)
+	}
+	if len(docType.Facets) > 0 {
+		fmt.Fprintf(&g.buf, ", with the facets %s", strings.Join(docType.Facets, ", "))
+	}
+	fmt.Fprintf(&g.buf, "\ntype %s struct {\nDocumentMeta\n", typeName)
+	for _, ref := range docType.Schemas {
+		fmt.Fprintf(&g.buf, "%s\n", schemaTypeName(ref))
+	}
+	fmt.Fprintf(&g.buf, "}\n\n")
+
+	fmt.Fprintf(&g.buf, "// New%s creates a %s document named name\n", typeName, name)
+	fmt.Fprintf(&g.buf, "func New%s(name string) *%s {\nreturn &%s{DocumentMeta: DocumentMeta{Name: name}}\n}\n\n", typeName, typeName, typeName)
+
+	fmt.Fprintf(&g.buf, "// %sFrom maps doc to a %s\n", typeName, name)
+	fmt.Fprintf(&g.buf, "func %sFrom(doc nuxeoclient.Document) (*%s, error) {\nv := &%s{}\nerr := doc.Unmarshal(v)\nreturn v, err\n}\n\n", typeName, typeName, typeName)
+
+	fmt.Fprintf(&g.buf, "// Document maps v to a document ready for CreateDocument or UpdateDocument\n")
+	fmt.Fprintf(&g.buf, "func (v *%s) Document() (nuxeoclient.Document, error) {\ndoc, err := nuxeoclient.DocumentFrom(v)\ndoc.Type = %sType\nreturn doc, err\n}\n\n", typeName, typeName)
+}
+
+func (g *generator) schema(s nuxeoclient.Schema) {
+	typeName := schemaTypeName(s.Name)
+
+	g.fields(&g.buf, typeName, fmt.Sprintf("holds the properties of the %s schema", s.Name), s.XPathPrefix()+":", s.Fields)
+}
+
+// fields writes the struct typeName, its fields being tagged with xpathPrefix followed by their name
+func (g *generator) fields(buf *bytes.Buffer, typeName string, doc string, xpathPrefix string, fields map[string]nuxeoclient.Field) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Nested complex types are written while the struct is built, so it goes to buf once complete
+	var structBuf bytes.Buffer
+	fmt.Fprintf(&structBuf, "// %s %s\ntype %s struct {\n", typeName, doc, typeName)
+	for _, name := range names {
+		fieldName := identifier(name)
+		fmt.Fprintf(&structBuf, "%s %s `nuxeo:\"%s%s,omitempty\"`\n", fieldName, g.goType(typeName+fieldName, fields[name]), xpathPrefix, name)
+	}
+	fmt.Fprintf(&structBuf, "}\n\n")
+	buf.Write(structBuf.Bytes())
+}
+
+// goType returns the Go type of f, generating complexName for complex fields
+func (g *generator) goType(complexName string, f nuxeoclient.Field) string {
+	var goType string
+	if f.Type == "complex" {
+		g.fields(&g.complexTypes, complexName, "is a complex property", "", f.Fields)
+		goType = complexName
+	} else if scalar, ok := scalarTypes[f.Type]; ok {
+		goType = scalar
+	} else {
+		goType = "interface{}"
+	}
+
+	if goType == "time.Time" {
+		g.usesTime = true
+	}
+
+	switch {
+	case f.Multiple:
+		return "[]" + goType
+	case goType == "time.Time", goType == "nuxeoclient.BlobProperty":
+		// Pointers let null dates and blobs be told apart from zero values
+		return "*" + goType
+	}
+	return goType
+}
+
+func schemaTypeName(name string) string {
+	return identifier(name) + "Schema"
+}
+
+// identifier turns a Nuxeo name such as "dublincore", "lastContributor" or "my-type" into an exported Go name
+func identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	id := b.String()
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		id = "X" + id
+	}
+	return id
+}
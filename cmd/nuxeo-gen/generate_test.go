@@ -0,0 +1,77 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTypes = `{"doctypes":{
+	"File":{"parent":"Document","facets":["Downloadable"],"schemas":["dublincore","files"]},
+	"Note":{"parent":"Document","schemas":[{"name":"note"}]}
+}}`
+
+const testSchemas = `[
+	{"name":"dublincore","@prefix":"dc","fields":{"title":"string","subjects":"string[]","created":"date"}},
+	{"name":"files","@prefix":"files","fields":{"files":{"type":"complex[]","fields":{"file":"blob","meta":{"type":"complex","fields":{"label":"string"}}}}}},
+	{"name":"note","fields":{"note":"string","mime_type":"string"}}
+]`
+
+func TestGenerate(t *testing.T) {
+	assert := assert.New(t)
+
+	reg, err := parseRegistry([]byte(testTypes), []byte(testSchemas))
+
+	assert.Nil(err)
+	assert.Equal("note", reg.DocTypes["Note"].Schemas[0])
+	assert.Equal("complex", reg.Schemas["files"].Fields["files"].Type)
+	assert.True(reg.Schemas["files"].Fields["files"].Multiple)
+
+	source, err := generate("doctypes", reg, []string{"File"})
+
+	assert.Nil(err)
+
+	code := string(source)
+	assert.Contains(code, "package doctypes")
+	assert.Contains(code, "type File struct {\n\tDocumentMeta\n\tDublincoreSchema\n\tFilesSchema\n}")
+	assert.Contains(code, "Created  *time.Time `nuxeo:\"dc:created,omitempty\"`")
+	assert.Contains(code, "Files []FilesSchemaFiles `nuxeo:\"files:files,omitempty\"`")
+	assert.Contains(code, "Label string `nuxeo:\"label,omitempty\"`")
+	assert.Contains(code, "func NewFile(name string) *File")
+	assert.NotContains(code, "NoteSchema")
+
+	source, err = generate("doctypes", reg, []string{"Note"})
+
+	assert.Nil(err)
+	assert.Contains(string(source), "MimeType string `nuxeo:\"note:mime_type,omitempty\"`")
+	assert.NotContains(string(source), "\"time\"")
+
+	_, err = generate("doctypes", reg, []string{"Folder"})
+	assert.NotNil(err)
+}
+
+func TestIdentifier(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("Dublincore", identifier("dublincore"))
+	assert.Equal("LastContributor", identifier("lastContributor"))
+	assert.Equal("MimeType", identifier("mime_type"))
+	assert.Equal("X3d", identifier("3d"))
+}
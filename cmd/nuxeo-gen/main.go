@@ -0,0 +1,157 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+// nuxeo-gen generates Go structs for Nuxeo document types, mapped with nuxeo tags
+// to be used with Document.Unmarshal and DocumentFrom.
+//
+// The definitions are read from a live server:
+//
+//	//go:generate go run github.com/vpasquier/nuxeo-go-client/cmd/nuxeo-gen -url http://localhost:8080/nuxeo -only File,Note -o doctypes.go
+//
+// or from the saved outputs of /api/v1/config/types and /api/v1/config/schemas:
+//
+//	//go:generate go run github.com/vpasquier/nuxeo-go-client/cmd/nuxeo-gen -types types.json -schemas schemas.json -o doctypes.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	nuxeoclient "github.com/vpasquier/nuxeo-go-client"
+)
+
+func main() {
+	url := flag.String("url", os.Getenv("NUXEO_URL"), "url of the Nuxeo server, defaults to $NUXEO_URL")
+	username := flag.String("username", envOr("NUXEO_USERNAME", "Administrator"), "username, defaults to $NUXEO_USERNAME")
+	password := flag.String("password", envOr("NUXEO_PASSWORD", "Administrator"), "password, defaults to $NUXEO_PASSWORD")
+	typesFile := flag.String("types", "", "saved output of /api/v1/config/types, instead of a live server")
+	schemasFile := flag.String("schemas", "", "saved output of /api/v1/config/schemas, instead of a live server")
+	only := flag.String("only", "", "comma separated document types to generate, all by default")
+	pkg := flag.String("package", envOr("GOPACKAGE", "doctypes"), "package of the generated file, defaults to the one running go generate")
+	output := flag.String("o", "", "output file, stdout by default")
+	flag.Parse()
+
+	var reg registry
+	var err error
+
+	if *typesFile != "" || *schemasFile != "" {
+		reg, err = readFiles(*typesFile, *schemasFile)
+	} else {
+		reg, err = fetch(*url, *username, *password)
+	}
+	exitOnError(err)
+
+	var names []string
+	if *only != "" {
+		names = strings.Split(*only, ",")
+	}
+
+	source, err := generate(*pkg, reg, names)
+	exitOnError(err)
+
+	if *output == "" {
+		_, err = os.Stdout.Write(source)
+	} else {
+		err = ioutil.WriteFile(*output, source, 0644)
+	}
+	exitOnError(err)
+}
+
+func readFiles(typesFile string, schemasFile string) (registry, error) {
+	if typesFile == "" || schemasFile == "" {
+		return registry{}, fmt.Errorf("both -types and -schemas are required")
+	}
+
+	typesData, err := ioutil.ReadFile(typesFile)
+	if err != nil {
+		return registry{}, err
+	}
+
+	schemasData, err := ioutil.ReadFile(schemasFile)
+	if err != nil {
+		return registry{}, err
+	}
+
+	return parseRegistry(typesData, schemasData)
+}
+
+func fetch(url string, username string, password string) (registry, error) {
+	if url == "" {
+		url = nuxeoclient.DefaultURL
+	}
+
+	ctx := context.Background()
+	config := nuxeoclient.NuxeoClient().URL(url).Username(username).Password(password).Build().Config()
+
+	docTypes, err := config.Types(ctx)
+	if err != nil {
+		return registry{}, err
+	}
+
+	schemas, err := config.Schemas(ctx)
+	return registry{DocTypes: docTypes, Schemas: schemas}, err
+}
+
+// registry holds the document types and schemas read from the server
+type registry struct {
+	DocTypes map[string]nuxeoclient.DocType
+	Schemas  map[string]nuxeoclient.Schema
+}
+
+// parseRegistry reads the saved outputs of /api/v1/config/types and /api/v1/config/schemas
+func parseRegistry(typesData []byte, schemasData []byte) (registry, error) {
+	var types struct {
+		DocTypes map[string]nuxeoclient.DocType `json:"doctypes"`
+	}
+	if err := json.Unmarshal(typesData, &types); err != nil {
+		return registry{}, fmt.Errorf("cannot read document types: %w", err)
+	}
+
+	var schemas []nuxeoclient.Schema
+	if err := json.Unmarshal(schemasData, &schemas); err != nil {
+		return registry{}, fmt.Errorf("cannot read schemas: %w", err)
+	}
+
+	reg := registry{
+		DocTypes: types.DocTypes,
+		Schemas:  make(map[string]nuxeoclient.Schema),
+	}
+	for _, s := range schemas {
+		reg.Schemas[s.Name] = s
+	}
+
+	return reg, nil
+}
+
+func envOr(name string, defaultValue string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nuxeo-gen:", err)
+		os.Exit(1)
+	}
+}
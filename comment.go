@@ -0,0 +1,353 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Comment is a comment on a document, or a reply to another comment
+type Comment struct {
+	EntityType       string     `json:"entity-type"`
+	ID               string     `json:"id,omitempty"`
+	ParentID         string     `json:"parentId,omitempty"`
+	AncestorIDs      []string   `json:"ancestorIds,omitempty"`
+	Author           string     `json:"author,omitempty"`
+	Text             string     `json:"text"`
+	CreationDate     *time.Time `json:"creationDate,omitempty"`
+	ModificationDate *time.Time `json:"modificationDate,omitempty"`
+	NumberOfReplies  int        `json:"numberOfReplies,omitempty"`
+	LastReplyDate    *time.Time `json:"lastReplyDate,omitempty"`
+	// EntityID, Origin and Entity identify comments created by an external system
+	EntityID    string `json:"entityId,omitempty"`
+	Origin      string `json:"origin,omitempty"`
+	Entity      string `json:"entity,omitempty"`
+	nuxeoClient *nuxeoClient
+}
+
+// Comments represents a page of comments
+type Comments struct {
+	Comments            []Comment `json:"entries"`
+	TotalSize           int       `json:"totalSize"`
+	CurrentPageIndex    int       `json:"currentPageIndex"`
+	NumberOfPages       int       `json:"numberOfPages"`
+	PageSize            int       `json:"pageSize"`
+	IsNextPageAvailable bool      `json:"isNextPageAvailable"`
+}
+
+// Annotation is a comment on a blob of a document, XPath being the blob property such as "file:content"
+type Annotation struct {
+	Comment
+	XPath string `json:"xpath"`
+}
+
+// NewComment creates a comment, ready to be passed to CreateComment
+func NewComment(text string) Comment {
+	return Comment{
+		EntityType: "comment",
+		Text:       text,
+	}
+}
+
+// NewAnnotation creates an annotation of the blob at xpath, ready to be passed to CreateAnnotation
+func NewAnnotation(xpath string, text string) Annotation {
+	return Annotation{
+		Comment: Comment{
+			EntityType: "annotation",
+			Text:       text,
+		},
+		XPath: xpath,
+	}
+}
+
+// bound fails with ErrNotBound when the comment has not been returned by the client
+func (comment Comment) bound() error {
+	if comment.nuxeoClient == nil {
+		return ErrNotBound
+	}
+	return nil
+}
+
+// attach binds the client to every comment of the page
+func (comments *Comments) attach(nuxeoClient *nuxeoClient) {
+	for i := range comments.Comments {
+		comments.Comments[i].nuxeoClient = nuxeoClient
+	}
+}
+
+// FetchComments returns a page of the comments of the document, replies excluded
+func (doc Document) FetchComments(ctx context.Context, pageSize int, currentPageIndex int) (Comments, error) {
+	if err := doc.bound(); err != nil {
+		return Comments{}, err
+	}
+
+	return doc.nuxeoClient.fetchComments(ctx, doc.nuxeoClient.documentURL(doc), pageSize, currentPageIndex)
+}
+
+// CreateComment adds comment to the document
+func (doc Document) CreateComment(ctx context.Context, comment Comment) (Comment, error) {
+	if err := doc.bound(); err != nil {
+		return Comment{}, err
+	}
+
+	return doc.nuxeoClient.createComment(ctx, doc.nuxeoClient.documentURL(doc), doc.UID, comment)
+}
+
+// FetchComment returns the comment with the given id
+func (doc Document) FetchComment(ctx context.Context, id string) (Comment, error) {
+	if err := doc.bound(); err != nil {
+		return Comment{}, err
+	}
+
+	var comment Comment
+	err := doc.nuxeoClient.commentRequest(ctx, doc, "/@comment/"+url.PathEscape(id), "GET", nil, &comment)
+
+	comment.nuxeoClient = doc.nuxeoClient
+
+	return comment, err
+}
+
+// UpdateComment saves the text of comment
+func (doc Document) UpdateComment(ctx context.Context, comment Comment) (Comment, error) {
+	if err := doc.bound(); err != nil {
+		return Comment{}, err
+	}
+
+	var updated Comment
+	err := doc.nuxeoClient.commentRequest(ctx, doc, "/@comment/"+url.PathEscape(comment.ID), "PUT", comment, &updated)
+
+	updated.nuxeoClient = doc.nuxeoClient
+
+	return updated, err
+}
+
+// DeleteComment deletes the comment with the given id, and its replies
+func (doc Document) DeleteComment(ctx context.Context, id string) error {
+	if err := doc.bound(); err != nil {
+		return err
+	}
+
+	return doc.nuxeoClient.commentRequest(ctx, doc, "/@comment/"+url.PathEscape(id), "DELETE", nil, nil)
+}
+
+// Reply answers the comment
+func (comment Comment) Reply(ctx context.Context, reply Comment) (Comment, error) {
+	if err := comment.bound(); err != nil {
+		return Comment{}, err
+	}
+
+	return comment.nuxeoClient.createComment(ctx, comment.nuxeoClient.idURL(comment.ID), comment.ID, reply)
+}
+
+// FetchReplies returns a page of the direct replies to the comment
+func (comment Comment) FetchReplies(ctx context.Context, pageSize int, currentPageIndex int) (Comments, error) {
+	if err := comment.bound(); err != nil {
+		return Comments{}, err
+	}
+
+	return comment.nuxeoClient.fetchComments(ctx, comment.nuxeoClient.idURL(comment.ID), pageSize, currentPageIndex)
+}
+
+// WalkReplies calls fn on every reply of the thread below the comment, depth first, stopping at the first error
+func (comment Comment) WalkReplies(ctx context.Context, fn func(reply Comment, depth int) error) error {
+	if err := comment.bound(); err != nil {
+		return err
+	}
+
+	return comment.walkReplies(ctx, fn, 1)
+}
+
+func (comment Comment) walkReplies(ctx context.Context, fn func(reply Comment, depth int) error, depth int) error {
+	for currentPageIndex := 0; ; currentPageIndex++ {
+		replies, err := comment.FetchReplies(ctx, DefaultPageSize, currentPageIndex)
+		if err != nil {
+			return err
+		}
+
+		for _, reply := range replies.Comments {
+			if err := fn(reply, depth); err != nil {
+				return err
+			}
+			if reply.NumberOfReplies > 0 {
+				if err := reply.walkReplies(ctx, fn, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !replies.IsNextPageAvailable {
+			return nil
+		}
+	}
+}
+
+// FetchAnnotations returns the annotations of the blob at xpath, such as "file:content"
+func (doc Document) FetchAnnotations(ctx context.Context, xpath string) ([]Annotation, error) {
+	if err := doc.bound(); err != nil {
+		return nil, err
+	}
+
+	var annotations struct {
+		Annotations []Annotation `json:"entries"`
+	}
+	err := doc.nuxeoClient.commentRequest(ctx, doc, "/@annotation?xpath="+url.QueryEscape(xpath), "GET", nil, &annotations)
+
+	for i := range annotations.Annotations {
+		annotations.Annotations[i].nuxeoClient = doc.nuxeoClient
+	}
+
+	return annotations.Annotations, err
+}
+
+// CreateAnnotation adds annotation to the document
+func (doc Document) CreateAnnotation(ctx context.Context, annotation Annotation) (Annotation, error) {
+	if err := doc.bound(); err != nil {
+		return Annotation{}, err
+	}
+
+	annotation.EntityType = "annotation"
+	// Omitted for documents known by path only, the server taking the parent from the url
+	annotation.ParentID = doc.UID
+
+	return doc.annotationRequest(ctx, "", "POST", annotation)
+}
+
+// FetchAnnotation returns the annotation with the given id
+func (doc Document) FetchAnnotation(ctx context.Context, id string) (Annotation, error) {
+	if err := doc.bound(); err != nil {
+		return Annotation{}, err
+	}
+
+	return doc.annotationRequest(ctx, "/"+url.PathEscape(id), "GET", nil)
+}
+
+// UpdateAnnotation saves the text of annotation
+func (doc Document) UpdateAnnotation(ctx context.Context, annotation Annotation) (Annotation, error) {
+	if err := doc.bound(); err != nil {
+		return Annotation{}, err
+	}
+
+	return doc.annotationRequest(ctx, "/"+url.PathEscape(annotation.ID), "PUT", annotation)
+}
+
+// DeleteAnnotation deletes the annotation with the given id, and its replies
+func (doc Document) DeleteAnnotation(ctx context.Context, id string) error {
+	if err := doc.bound(); err != nil {
+		return err
+	}
+
+	_, err := doc.annotationRequest(ctx, "/"+url.PathEscape(id), "DELETE", nil)
+	return err
+}
+
+// FetchAnnotationByEntityID returns the annotation created by an external system with the given entity id
+func (doc Document) FetchAnnotationByEntityID(ctx context.Context, entityID string) (Annotation, error) {
+	if err := doc.bound(); err != nil {
+		return Annotation{}, err
+	}
+
+	return doc.annotationRequest(ctx, "/external/"+url.PathEscape(entityID), "GET", nil)
+}
+
+// UpdateAnnotationByEntityID saves the annotation created by an external system with the entity id of annotation
+func (doc Document) UpdateAnnotationByEntityID(ctx context.Context, annotation Annotation) (Annotation, error) {
+	if err := doc.bound(); err != nil {
+		return Annotation{}, err
+	}
+
+	return doc.annotationRequest(ctx, "/external/"+url.PathEscape(annotation.EntityID), "PUT", annotation)
+}
+
+// DeleteAnnotationByEntityID deletes the annotation created by an external system with the given entity id
+func (doc Document) DeleteAnnotationByEntityID(ctx context.Context, entityID string) error {
+	if err := doc.bound(); err != nil {
+		return err
+	}
+
+	_, err := doc.annotationRequest(ctx, "/external/"+url.PathEscape(entityID), "DELETE", nil)
+	return err
+}
+
+func (doc Document) annotationRequest(ctx context.Context, path string, method string, body interface{}) (Annotation, error) {
+	var annotation Annotation
+	var result interface{} = &annotation
+	if method == "DELETE" {
+		result = nil
+	}
+
+	err := doc.nuxeoClient.commentRequest(ctx, doc, "/@annotation"+path, method, body, result)
+
+	annotation.nuxeoClient = doc.nuxeoClient
+
+	return annotation, err
+}
+
+// fetchComments returns a page of the comments of the document, or of the replies of the comment, at parentURL
+func (nuxeoClient *nuxeoClient) fetchComments(ctx context.Context, parentURL string, pageSize int, currentPageIndex int) (Comments, error) {
+	request := nuxeoClient.request(ctx).SetQueryParams(map[string]string{
+		"pageSize":         strconv.Itoa(pageSize),
+		"currentPageIndex": strconv.Itoa(currentPageIndex),
+	})
+
+	resp, err := request.Get(parentURL + "/@comment")
+
+	var comments Comments
+	err = HandleResponse(err, resp, &comments)
+
+	comments.attach(nuxeoClient)
+
+	return comments, err
+}
+
+// createComment adds comment to the document, or to the comment, at parentURL, parentID being omitted when unknown
+func (nuxeoClient *nuxeoClient) createComment(ctx context.Context, parentURL string, parentID string, comment Comment) (Comment, error) {
+	comment.EntityType = "comment"
+	comment.ParentID = parentID
+
+	body, err := json.Marshal(comment)
+
+	resp, err := nuxeoClient.request(ctx).SetBody(string(body[:])).Post(parentURL + "/@comment")
+
+	var created Comment
+	err = HandleResponse(err, resp, &created)
+
+	created.nuxeoClient = nuxeoClient
+
+	return created, err
+}
+
+// commentRequest sends a request to a comment or annotation adapter of doc
+func (nuxeoClient *nuxeoClient) commentRequest(ctx context.Context, doc Document, path string, method string, body interface{}, result interface{}) error {
+	request := nuxeoClient.request(ctx)
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		request.SetBody(string(data[:]))
+	}
+
+	resp, err := request.Execute(method, nuxeoClient.documentURL(doc)+path)
+
+	return HandleResponse(err, resp, result)
+}
@@ -0,0 +1,531 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidProperty is returned by Validate when a property does not match the schemas of the document type
+var ErrInvalidProperty = errors.New("nuxeo: invalid property")
+
+// Config is the configuration rest api representation, describing the document types, schemas and facets
+// of the server. The definitions are fetched once and cached until Invalidate is called.
+type Config interface {
+	Types(ctx context.Context) (map[string]DocType, error)
+	Type(ctx context.Context, name string) (DocType, error)
+	Schemas(ctx context.Context) (map[string]Schema, error)
+	Schema(ctx context.Context, name string) (Schema, error)
+	Facets(ctx context.Context) (map[string]Facet, error)
+	Facet(ctx context.Context, name string) (Facet, error)
+	Validate(ctx context.Context, doc Document) error
+	Invalidate()
+}
+
+// DocType describes a document type
+type DocType struct {
+	Name    string   `json:"name"`
+	Parent  string   `json:"parent"`
+	Facets  []string `json:"facets"`
+	Schemas []string `json:"schemas"`
+}
+
+// Schema describes a schema, its fields being keyed by name without prefix
+type Schema struct {
+	Name   string           `json:"name"`
+	Prefix string           `json:"@prefix"`
+	Fields map[string]Field `json:"fields"`
+}
+
+// Field describes a schema field, Type being one of string, integer, long, double, boolean, date, blob or complex.
+// Multiple fields are lists of Type, complex fields have their own Fields.
+type Field struct {
+	Type     string
+	Multiple bool
+	Fields   map[string]Field
+}
+
+// Facet describes a facet and the schemas it adds to the documents
+type Facet struct {
+	Name    string   `json:"name"`
+	Schemas []string `json:"schemas"`
+}
+
+// XPathPrefix is the prefix of the properties of the schema, such as "dc" for dublincore
+func (schema Schema) XPathPrefix() string {
+	if schema.Prefix != "" {
+		return schema.Prefix
+	}
+	return schema.Name
+}
+
+// copy returns a deep copy of the document type, for callers not to modify the cache
+func (docType DocType) copy() DocType {
+	docType.Facets = copyStrings(docType.Facets)
+	docType.Schemas = copyStrings(docType.Schemas)
+	return docType
+}
+
+// copy returns a deep copy of the schema, for callers not to modify the cache
+func (schema Schema) copy() Schema {
+	schema.Fields = copyFields(schema.Fields)
+	return schema
+}
+
+// copy returns a deep copy of the facet, for callers not to modify the cache
+func (facet Facet) copy() Facet {
+	facet.Schemas = copyStrings(facet.Schemas)
+	return facet
+}
+
+func copyFields(fields map[string]Field) map[string]Field {
+	if fields == nil {
+		return nil
+	}
+	copies := make(map[string]Field, len(fields))
+	for name, field := range fields {
+		field.Fields = copyFields(field.Fields)
+		copies[name] = field
+	}
+	return copies
+}
+
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(values)), values...)
+}
+
+// UnmarshalJSON reads the schemas listed either by name or as schema entities
+func (docType *DocType) UnmarshalJSON(data []byte) error {
+	type plainDocType DocType
+	var raw struct {
+		plainDocType
+		Schemas []json.RawMessage `json:"schemas"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*docType = DocType(raw.plainDocType)
+	var err error
+	docType.Schemas, err = schemaNames(raw.Schemas)
+
+	return err
+}
+
+// UnmarshalJSON reads the schemas listed either by name or as schema entities
+func (facet *Facet) UnmarshalJSON(data []byte) error {
+	type plainFacet Facet
+	var raw struct {
+		plainFacet
+		Schemas []json.RawMessage `json:"schemas"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*facet = Facet(raw.plainFacet)
+	var err error
+	facet.Schemas, err = schemaNames(raw.Schemas)
+
+	return err
+}
+
+// UnmarshalJSON reads a field written either as its type, such as "string[]", or as a complex field
+func (field *Field) UnmarshalJSON(data []byte) error {
+	var fieldType string
+
+	if err := json.Unmarshal(data, &fieldType); err != nil {
+		var complexField struct {
+			Type   string           `json:"type"`
+			Fields map[string]Field `json:"fields"`
+		}
+		if err := json.Unmarshal(data, &complexField); err != nil {
+			return err
+		}
+		fieldType = complexField.Type
+		field.Fields = complexField.Fields
+	}
+
+	field.Multiple = strings.HasSuffix(fieldType, "[]")
+	field.Type = strings.TrimSuffix(fieldType, "[]")
+
+	if field.Type == "" && field.Fields != nil {
+		field.Type = "complex"
+	}
+
+	return nil
+}
+
+func schemaNames(schemas []json.RawMessage) ([]string, error) {
+	names := make([]string, len(schemas))
+
+	for i, schema := range schemas {
+		if err := json.Unmarshal(schema, &names[i]); err == nil {
+			continue
+		}
+		var entity struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(schema, &entity); err != nil {
+			return nil, err
+		}
+		names[i] = entity.Name
+	}
+
+	return names, nil
+}
+
+type config struct {
+	nuxeoClient *nuxeoClient
+	// mutex guards the cache only, definitions are fetched without holding it
+	mutex sync.Mutex
+	// generation is increased by Invalidate, so that fetches started before are not cached
+	generation int
+	types      map[string]DocType
+	schemas    map[string]Schema
+	facets     map[string]Facet
+}
+
+// Types returns the document types keyed by name
+func (config *config) Types(ctx context.Context) (map[string]DocType, error) {
+	types, err := config.cachedTypes(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make(map[string]DocType, len(types))
+	for name, docType := range types {
+		copies[name] = docType.copy()
+	}
+
+	return copies, nil
+}
+
+// Type returns the document type name, the error matching ErrNotFound when it does not exist
+func (config *config) Type(ctx context.Context, name string) (DocType, error) {
+	types, err := config.cachedTypes(ctx)
+
+	if err != nil {
+		return DocType{}, err
+	}
+
+	docType, ok := types[name]
+	if !ok {
+		return DocType{}, fmt.Errorf("%w: document type %s", ErrNotFound, name)
+	}
+
+	return docType.copy(), nil
+}
+
+// Schemas returns the schemas keyed by name
+func (config *config) Schemas(ctx context.Context) (map[string]Schema, error) {
+	schemas, err := config.cachedSchemas(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make(map[string]Schema, len(schemas))
+	for name, schema := range schemas {
+		copies[name] = schema.copy()
+	}
+
+	return copies, nil
+}
+
+// Schema returns the schema name, the error matching ErrNotFound when it does not exist
+func (config *config) Schema(ctx context.Context, name string) (Schema, error) {
+	schemas, err := config.cachedSchemas(ctx)
+
+	if err != nil {
+		return Schema{}, err
+	}
+
+	schema, ok := schemas[name]
+	if !ok {
+		return Schema{}, fmt.Errorf("%w: schema %s", ErrNotFound, name)
+	}
+
+	return schema.copy(), nil
+}
+
+// Facets returns the facets keyed by name
+func (config *config) Facets(ctx context.Context) (map[string]Facet, error) {
+	facets, err := config.cachedFacets(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make(map[string]Facet, len(facets))
+	for name, facet := range facets {
+		copies[name] = facet.copy()
+	}
+
+	return copies, nil
+}
+
+// Facet returns the facet name, the error matching ErrNotFound when it does not exist
+func (config *config) Facet(ctx context.Context, name string) (Facet, error) {
+	facets, err := config.cachedFacets(ctx)
+
+	if err != nil {
+		return Facet{}, err
+	}
+
+	facet, ok := facets[name]
+	if !ok {
+		return Facet{}, fmt.Errorf("%w: facet %s", ErrNotFound, name)
+	}
+
+	return facet.copy(), nil
+}
+
+// Invalidate drops the cached definitions, they are fetched again on next use
+func (config *config) Invalidate() {
+	config.mutex.Lock()
+	defer config.mutex.Unlock()
+
+	config.generation++
+	config.types = nil
+	config.schemas = nil
+	config.facets = nil
+}
+
+// cachedTypes returns the cached document types, which must not be modified, fetching them on first use
+func (config *config) cachedTypes(ctx context.Context) (map[string]DocType, error) {
+	config.mutex.Lock()
+	cached, generation := config.types, config.generation
+	config.mutex.Unlock()
+
+	if cached != nil {
+		return cached, nil
+	}
+
+	var types struct {
+		DocTypes map[string]DocType `json:"doctypes"`
+	}
+	if err := config.fetch(ctx, "/types", &types); err != nil {
+		return nil, err
+	}
+
+	for name, docType := range types.DocTypes {
+		docType.Name = name
+		types.DocTypes[name] = docType
+	}
+
+	config.mutex.Lock()
+	if config.generation == generation {
+		config.types = types.DocTypes
+	}
+	config.mutex.Unlock()
+
+	return types.DocTypes, nil
+}
+
+// cachedSchemas returns the cached schemas, which must not be modified, fetching them on first use
+func (config *config) cachedSchemas(ctx context.Context) (map[string]Schema, error) {
+	config.mutex.Lock()
+	cached, generation := config.schemas, config.generation
+	config.mutex.Unlock()
+
+	if cached != nil {
+		return cached, nil
+	}
+
+	var list []Schema
+	if err := config.fetch(ctx, "/schemas", &list); err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]Schema, len(list))
+	for _, schema := range list {
+		schemas[schema.Name] = schema
+	}
+
+	config.mutex.Lock()
+	if config.generation == generation {
+		config.schemas = schemas
+	}
+	config.mutex.Unlock()
+
+	return schemas, nil
+}
+
+// cachedFacets returns the cached facets, which must not be modified, fetching them on first use
+func (config *config) cachedFacets(ctx context.Context) (map[string]Facet, error) {
+	config.mutex.Lock()
+	cached, generation := config.facets, config.generation
+	config.mutex.Unlock()
+
+	if cached != nil {
+		return cached, nil
+	}
+
+	var list []Facet
+	if err := config.fetch(ctx, "/facets", &list); err != nil {
+		return nil, err
+	}
+
+	facets := make(map[string]Facet, len(list))
+	for _, facet := range list {
+		facets[facet.Name] = facet
+	}
+
+	config.mutex.Lock()
+	if config.generation == generation {
+		config.facets = facets
+	}
+	config.mutex.Unlock()
+
+	return facets, nil
+}
+
+// Validate checks that the document type exists and that the properties of doc belong to its schemas
+// with values of the right type. The returned error matches ErrInvalidProperty or ErrNotFound.
+func (config *config) Validate(ctx context.Context, doc Document) error {
+	docType, err := config.Type(ctx, doc.Type)
+
+	if err != nil {
+		return err
+	}
+
+	schemas, err := config.cachedSchemas(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	byPrefix := make(map[string]Schema)
+	for _, name := range docType.Schemas {
+		schema := schemas[name]
+		byPrefix[schema.XPathPrefix()] = schema
+	}
+
+	for xpath, value := range doc.Properties {
+		segments := strings.SplitN(xpath, ":", 2)
+		schema, ok := byPrefix[segments[0]]
+
+		var field Field
+		if ok && len(segments) == 2 {
+			field, ok = schema.Fields[segments[1]]
+		}
+
+		if !ok {
+			return fmt.Errorf("%w: %s is not a property of %s", ErrInvalidProperty, xpath, doc.Type)
+		}
+
+		if err := field.validate(xpath, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validate checks that value, found at xpath, matches the field
+func (field Field) validate(xpath string, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+
+	if field.Multiple {
+		if rv.Kind() != reflect.Slice {
+			return fmt.Errorf("%w: %s expects a list, not %T", ErrInvalidProperty, xpath, value)
+		}
+		item := field
+		item.Multiple = false
+		for i := 0; i < rv.Len(); i++ {
+			if err := item.validate(fmt.Sprintf("%s/%d", xpath, i), rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var ok bool
+	switch field.Type {
+	case "string":
+		ok = rv.Kind() == reflect.String
+	case "integer", "long":
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			ok = true
+		case reflect.Float32, reflect.Float64:
+			ok = rv.Float() == float64(int64(rv.Float()))
+		}
+	case "double":
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+			ok = true
+		}
+	case "boolean":
+		ok = rv.Kind() == reflect.Bool
+	case "date":
+		_, ok = parseTime(value)
+	case "blob":
+		ok = rv.Kind() == reflect.Map || rv.Kind() == reflect.Struct
+	case "complex":
+		complexValue, isMap := value.(map[string]interface{})
+		if !isMap {
+			break
+		}
+		for name, subValue := range complexValue {
+			subField, known := field.Fields[name]
+			if !known {
+				return fmt.Errorf("%w: %s/%s is not a property", ErrInvalidProperty, xpath, name)
+			}
+			if err := subField.validate(xpath+"/"+name, subValue); err != nil {
+				return err
+			}
+		}
+		ok = true
+	default:
+		// Types unknown to the client are left to the server
+		ok = true
+	}
+
+	if !ok {
+		return fmt.Errorf("%w: %s expects a %s, not %T", ErrInvalidProperty, xpath, field.Type, value)
+	}
+
+	return nil
+}
+
+// fetch reads the configuration endpoint path into v
+func (config *config) fetch(ctx context.Context, path string, v interface{}) error {
+	url := config.nuxeoClient.url + "/api/v1/config" + path
+
+	resp, err := config.nuxeoClient.request(ctx).Get(url)
+
+	return HandleResponse(err, resp, v)
+}
@@ -0,0 +1,90 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MaxConflictRetries is the number of attempts of RetryOnConflict before giving up
+const MaxConflictRetries = 5
+
+// ConflictError is returned when a document update is rejected because the document
+// has been modified since its change token was fetched
+type ConflictError struct {
+	UID         string
+	ChangeToken string
+	Err         *NuxeoError
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("nuxeo: document %s has been modified since change token %s: %s", e.UID, e.ChangeToken, e.Err.Message)
+}
+
+// Unwrap exposes the server error, so that IsConflict and errors.Is(err, ErrConflict) match
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// newConflictError turns a 409 returned for doc into a ConflictError, other errors are returned as is
+func newConflictError(err error, doc Document) error {
+	var nuxeoErr *NuxeoError
+	if !IsConflict(err) || !errors.As(err, &nuxeoErr) {
+		return err
+	}
+	return &ConflictError{
+		UID:         doc.UID,
+		ChangeToken: doc.ChangeToken,
+		Err:         nuxeoErr,
+	}
+}
+
+// RetryOnConflict fetches a fresh document, applies mutate to it and updates it, starting over
+// with a new fetch when another writer updated the document in between. It gives up after
+// MaxConflictRetries attempts and returns the last ConflictError.
+func (nuxeoClient *nuxeoClient) RetryOnConflict(ctx context.Context, fetch func(context.Context) (Document, error), mutate func(*Document) error, options ...UpdateOption) (Document, error) {
+	var err error
+
+	for attempt := 0; attempt < MaxConflictRetries; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Document{}, ctxErr
+		}
+
+		var doc Document
+		doc, err = fetch(ctx)
+
+		if err != nil {
+			return Document{}, err
+		}
+
+		if err = mutate(&doc); err != nil {
+			return Document{}, err
+		}
+
+		var updated Document
+		updated, err = nuxeoClient.UpdateDocument(ctx, doc, options...)
+
+		if !IsConflict(err) {
+			return updated, err
+		}
+	}
+
+	return Document{}, err
+}
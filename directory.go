@@ -18,54 +18,63 @@
 package nuxeoclient
 
 import (
+	"context"
 	"encoding/json"
+	"net/url"
 )
 
-// Directory represents a Nuxeo directory
-type directory struct {
+// DirectoryEntry represents a Nuxeo directory entry
+type DirectoryEntry struct {
 	EntityType    string                 `json:"entity-type"`
 	DirectoryName string                 `json:"directoryName"`
 	ID            string                 `json:"id"`
 	Properties    map[string]interface{} `json:"properties"`
 }
 
-// DirectorySet represents a Nuxeo directory set
-type directorySet struct {
-	Entries []directory `json:"entries"`
+// DirectoryEntries represents a set of Nuxeo directory entries
+type DirectoryEntries struct {
+	Entries []DirectoryEntry `json:"entries"`
 }
 
-func (nuxeoClient *nuxeoClient) GetDirectory(directory string) (directorySet, error) {
-	uri := nuxeoClient.url + "/api/v1/directory/" + directory
+// NewDirectoryEntry creates an entry of the given directory, ready to be passed to CreateDirectory
+func NewDirectoryEntry(directoryName string, properties map[string]interface{}) DirectoryEntry {
+	return DirectoryEntry{
+		EntityType:    "directoryEntry",
+		DirectoryName: directoryName,
+		Properties:    properties,
+	}
+}
+
+func (nuxeoClient *nuxeoClient) GetDirectory(ctx context.Context, name string) (DirectoryEntries, error) {
+	uri := nuxeoClient.url + "/api/v1/directory/" + url.PathEscape(name)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Get(uri)
+	resp, err := nuxeoClient.request(ctx).Get(uri)
 
-	var directorySet directorySet
-	err = HandleResponse(err, resp, &directorySet)
+	var entries DirectoryEntries
+	err = HandleResponse(err, resp, &entries)
 
-	return directorySet, err
+	return entries, err
 }
 
-func (nuxeoClient *nuxeoClient) CreateDirectory(name string, dir directory) (directory, error) {
+func (nuxeoClient *nuxeoClient) CreateDirectory(ctx context.Context, name string, dir DirectoryEntry) (DirectoryEntry, error) {
 
-	uri := nuxeoClient.url + "/api/v1/directory/" + name
+	uri := nuxeoClient.url + "/api/v1/directory/" + url.PathEscape(name)
 
 	body, err := json.Marshal(dir)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Post(uri)
+	resp, err := nuxeoClient.request(ctx).SetBody(string(body[:])).Post(uri)
 
-	var newDir directory
+	var newDir DirectoryEntry
 	err = HandleResponse(err, resp, &newDir)
 
 	return newDir, err
 }
 
-func (nuxeoClient *nuxeoClient) DeleteDirectory(name string, entry string) error {
-
-	uri := nuxeoClient.url + "/api/v1/directory/" + name + "/" + entry
+func (nuxeoClient *nuxeoClient) DeleteDirectory(ctx context.Context, name string, entry string) error {
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Delete(uri)
+	uri := nuxeoClient.url + "/api/v1/directory/" + url.PathEscape(name) + "/" + url.PathEscape(entry)
 
-	_ = resp
+	resp, err := nuxeoClient.request(ctx).Delete(uri)
 
-	return err
+	return HandleResponse(err, resp, nil)
 }
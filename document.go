@@ -17,55 +17,240 @@
 
 package nuxeoclient
 
-// Document represents a Nuxeo document
-type document struct {
-	EntityType  string                 `json:"entity-type"`
-	UID         string                 `json:"uid"`
-	Path        string                 `json:"path"`
-	Type        string                 `json:"type"`
-	Name        string                 `json:"name"`
-	Properties  map[string]interface{} `json:"properties"`
-	nuxeoClient nuxeoClient
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Document represents a Nuxeo document. Its methods calling the server only work on documents
+// returned by the client, they fail with ErrNotBound on the ones built with NewDocument or DocumentFrom.
+type Document struct {
+	EntityType   string                 `json:"entity-type"`
+	UID          string                 `json:"uid"`
+	Path         string                 `json:"path"`
+	Type         string                 `json:"type"`
+	Name         string                 `json:"name"`
+	Properties   map[string]interface{} `json:"properties"`
+	VersionLabel string                 `json:"versionLabel,omitempty"`
+	IsCheckedOut bool                   `json:"isCheckedOut,omitempty"`
+	IsVersion    bool                   `json:"isVersion,omitempty"`
+	LockOwner    string                 `json:"lockOwner,omitempty"`
+	LockCreated  *time.Time             `json:"lockCreated,omitempty"`
+	ChangeToken  string                 `json:"changeToken,omitempty"`
+	LastModified *time.Time             `json:"lastModified,omitempty"`
+	IsTrashed    bool                   `json:"isTrashed,omitempty"`
+	// ContextParameters holds the output of the enrichers
+	ContextParameters map[string]json.RawMessage `json:"contextParameters,omitempty"`
+	nuxeoClient       *nuxeoClient
+	// snapshot holds the JSON of the properties as returned by the server, nil for documents built locally
+	snapshot map[string]string
+}
+
+// Documents represents a page of Nuxeo documents
+type Documents struct {
+	Documents           []Document `json:"entries"`
+	TotalSize           int        `json:"totalSize"`
+	CurrentPageIndex    int        `json:"currentPageIndex"`
+	NumberOfPages       int        `json:"numberOfPages"`
+	PageSize            int        `json:"pageSize"`
+	ResultsCount        int        `json:"resultsCount"`
+	IsNextPageAvailable bool       `json:"isNextPageAvailable"`
 }
 
-type recordSet struct {
-	Documents        []document `json:"entries"`
-	TotalSize        int        `json:"totalSize"`
-	CurrentPageIndex int        `json:"currentPageIndex"`
-	NumberOfPages    int        `json:"numberOfPages"`
+// NewDocument creates a document of the given type, ready to be passed to CreateDocument
+func NewDocument(docType string, name string) Document {
+	return Document{
+		EntityType: "document",
+		Type:       docType,
+		Name:       name,
+		Properties: make(map[string]interface{}),
+	}
 }
 
-func (doc document) FetchChildren() recordSet {
-	url := doc.nuxeoClient.url + "/api/v1/path" + doc.Path + "/@children"
+// attach binds the client to every document of the page
+func (records *Documents) attach(nuxeoClient *nuxeoClient) {
+	for i := range records.Documents {
+		records.Documents[i].nuxeoClient = nuxeoClient
+	}
+}
 
-	resp, err := doc.nuxeoClient.client.R().EnableTrace().Get(url)
-	var recordSet recordSet
-	HandleResponse(err, resp, &recordSet)
+// UnmarshalJSON reads the document and keeps a snapshot of its properties, for UpdateDocument to send only the changed ones
+func (doc *Document) UnmarshalJSON(data []byte) error {
+	type document Document
+	if err := json.Unmarshal(data, (*document)(doc)); err != nil {
+		return err
+	}
 
-	for key, entry := range recordSet.Documents {
-		_ = key
-		entry.nuxeoClient = doc.nuxeoClient
+	doc.snapshot = make(map[string]string, len(doc.Properties))
+	for name, value := range doc.Properties {
+		property, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		doc.snapshot[name] = string(property)
 	}
 
-	return recordSet
+	return nil
 }
 
-func (doc document) FetchBlob(xpath string) ([]byte, error) {
-	url := doc.nuxeoClient.url + "/api/v1/path" + doc.Path + "/@blob/" + xpath
+// Set changes the property at xpath, such as "dc:title" or "files:files/0/file", creating the
+// missing complex properties and list items
+func (doc *Document) Set(xpath string, value interface{}) error {
+	segments := strings.Split(xpath, "/")
+
+	if doc.Properties == nil {
+		doc.Properties = make(map[string]interface{})
+	}
+
+	property, err := setPath(doc.Properties[segments[0]], segments[1:], value)
+	if err != nil {
+		return fmt.Errorf("nuxeo: cannot set %s: %w", xpath, err)
+	}
+
+	doc.Properties[segments[0]] = property
+
+	return nil
+}
 
-	resp, err := doc.nuxeoClient.client.R().EnableTrace().Get(url)
+// Clear sets the property at xpath to null on the next UpdateDocument
+func (doc *Document) Clear(xpath string) error {
+	return doc.Set(xpath, nil)
+}
 
-	return resp.Body(), err
+// IsDirty reports whether properties have been changed, with Set or directly through Properties, since the
+// document was fetched. Documents built locally are dirty as soon as they have properties
+func (doc Document) IsDirty() bool {
+	changed, err := doc.changedProperties()
+	return err != nil || len(changed) > 0
 }
 
-func (doc document) AsyncFetchBlob(xpath string, c chan []byte) {
-	url := doc.nuxeoClient.url + "/api/v1/path" + doc.Path + "/@blob/" + xpath
+// changedProperties returns the properties which differ from the snapshot, all of them for documents built locally.
+// Properties removed from the map are left unchanged on the server, Clear sets them to null
+func (doc Document) changedProperties() (map[string]interface{}, error) {
+	if doc.snapshot == nil {
+		return doc.Properties, nil
+	}
+
+	changed := make(map[string]interface{})
+	for name, value := range doc.Properties {
+		property, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if original, ok := doc.snapshot[name]; !ok || original != string(property) {
+			changed[name] = value
+		}
+	}
 
-	resp, err := doc.nuxeoClient.client.R().EnableTrace().Get(url)
+	return changed, nil
+}
 
+// updateBody is the document sent on update, holding only its changed properties
+func (doc Document) updateBody() ([]byte, error) {
+	properties, err := doc.changedProperties()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	doc.Properties = properties
+	return json.Marshal(doc)
+}
+
+// bound fails with ErrNotBound when the document has not been returned by the client
+func (doc Document) bound() error {
+	if doc.nuxeoClient == nil {
+		return ErrNotBound
+	}
+	return nil
+}
+
+// ContextParameter decodes into v the output of the enricher name
+func (doc Document) ContextParameter(name string, v interface{}) error {
+	data, ok := doc.ContextParameters[name]
+
+	if !ok {
+		return fmt.Errorf("nuxeo: context parameter %q is missing, is the enricher set?", name)
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// fetchEnriched refetches the document with enrichers on top of the client ones
+func (doc Document) fetchEnriched(ctx context.Context, enrichers ...string) (Document, error) {
+	url := doc.nuxeoClient.documentURL(doc)
+
+	resp, err := doc.nuxeoClient.request(ctx).SetHeaders(doc.nuxeoClient.enrichersHeader(enrichers...)).Get(url)
+
+	var currentDoc Document
+	err = HandleResponse(err, resp, &currentDoc)
+
+	currentDoc.nuxeoClient = doc.nuxeoClient
+
+	return currentDoc, err
+}
+
+func (doc Document) FetchChildren(ctx context.Context) (Documents, error) {
+	if err := doc.bound(); err != nil {
+		return Documents{}, err
+	}
+
+	return doc.fetchChildren(ctx, doc.nuxeoClient.request(ctx))
+}
+
+// ChildrenIterator walks all the children of the document, pageSize at a time
+func (doc Document) ChildrenIterator(pageSize int) *QueryIterator {
+	if err := doc.bound(); err != nil {
+		return &QueryIterator{pager: pager{err: err}}
+	}
+
+	return newQueryIterator(pageSize, func(ctx context.Context, pageSize int, currentPageIndex int) (Documents, error) {
+		request := doc.nuxeoClient.request(ctx).SetQueryParams(map[string]string{
+			"pageSize":         strconv.Itoa(pageSize),
+			"currentPageIndex": strconv.Itoa(currentPageIndex),
+		})
+		return doc.fetchChildren(ctx, request)
+	})
+}
+
+func (doc Document) fetchChildren(ctx context.Context, request *resty.Request) (Documents, error) {
+	url := doc.nuxeoClient.documentURL(doc) + "/@children"
+
+	resp, err := request.Get(url)
+	var records Documents
+	err = HandleResponse(err, resp, &records)
+
+	records.attach(doc.nuxeoClient)
+
+	return records, err
+}
+
+func (doc Document) FetchBlob(ctx context.Context, xpath string) ([]byte, error) {
+	if err := doc.bound(); err != nil {
+		return nil, err
+	}
+
+	url := doc.nuxeoClient.documentURL(doc) + "/@blob/" + escapePath(xpath)
+
+	resp, err := doc.nuxeoClient.request(ctx).Get(url)
+
+	if err = checkResponse(err, resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Body(), nil
+}
+
+func (doc Document) AsyncFetchBlob(ctx context.Context, xpath string) BlobFuture {
+	if err := doc.bound(); err != nil {
+		return BlobFuture{failedFuture(err)}
 	}
 
-	c <- resp.Body()
+	return BlobFuture{doc.nuxeoClient.async(ctx, func() (interface{}, error) {
+		return doc.FetchBlob(ctx, xpath)
+	})}
 }
@@ -0,0 +1,110 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	// ErrNotFound matches any 404 returned by the server
+	ErrNotFound = errors.New("nuxeo: resource not found")
+	// ErrUnauthorized matches any 401 returned by the server
+	ErrUnauthorized = errors.New("nuxeo: unauthorized")
+	// ErrForbidden matches any 403 returned by the server
+	ErrForbidden = errors.New("nuxeo: forbidden")
+	// ErrConflict matches any 409 returned by the server
+	ErrConflict = errors.New("nuxeo: conflict")
+	// ErrNotBound is returned by the methods of documents and comments built locally, such as with NewDocument,
+	// rather than returned by the client
+	ErrNotBound = errors.New("nuxeo: not bound to a client, use the document returned by the client")
+)
+
+// NuxeoError is the error returned when the server answers with an error status
+type NuxeoError struct {
+	EntityType string `json:"entity-type"`
+	Status     int    `json:"status"`
+	Message    string `json:"message"`
+	StackTrace string `json:"stacktrace"`
+	URL        string `json:"-"`
+}
+
+func (e *NuxeoError) Error() string {
+	return fmt.Sprintf("nuxeo: %d %s (%s)", e.Status, e.Message, e.URL)
+}
+
+// Is makes the error comparable to the sentinel errors with errors.Is
+func (e *NuxeoError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.Status == http.StatusForbidden
+	case ErrConflict:
+		return e.Status == http.StatusConflict
+	}
+	return false
+}
+
+// IsNotFound reports whether err is a 404 from the server
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsUnauthorized reports whether err is a 401 from the server
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+// IsForbidden reports whether err is a 403 from the server
+func IsForbidden(err error) bool {
+	return errors.Is(err, ErrForbidden)
+}
+
+// IsConflict reports whether err is a 409 from the server
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+// newNuxeoError builds the error from the response, using the Nuxeo exception entity of data when present
+func newNuxeoError(resp *resty.Response, data []byte) *NuxeoError {
+	nuxeoErr := &NuxeoError{}
+
+	if json.Valid(data) {
+		json.Unmarshal(data, nuxeoErr)
+	}
+
+	if nuxeoErr.Status == 0 {
+		nuxeoErr.Status = resp.StatusCode()
+	}
+	if nuxeoErr.Message == "" {
+		nuxeoErr.Message = resp.Status()
+	}
+	if resp.Request != nil {
+		nuxeoErr.URL = resp.Request.URL
+	}
+
+	return nuxeoErr
+}
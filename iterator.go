@@ -0,0 +1,162 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// DefaultPageSize is the page size used by iterators if none has been set
+	DefaultPageSize = 50
+)
+
+// pageLoader loads the page at pageIndex into its iterator, returning the number of items and whether a next page is available
+type pageLoader func(ctx context.Context, pageIndex int) (size int, hasNext bool, err error)
+
+// pager holds the paging state shared by the iterators, the pages themselves being kept by each iterator
+type pager struct {
+	pageSize  int
+	pageIndex int
+	size      int
+	hasNext   bool
+	position  int
+	started   bool
+	err       error
+}
+
+func newPager(pageSize int) pager {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return pager{pageSize: pageSize}
+}
+
+// next moves to the next item, loading the pages as needed, and returns its position in the current page.
+// It returns false once all pages have been read or on error.
+func (p *pager) next(ctx context.Context, load pageLoader) (int, bool) {
+	if p.err != nil {
+		return 0, false
+	}
+
+	for p.position >= p.size {
+		if p.started && !p.hasNext {
+			return 0, false
+		}
+
+		size, hasNext, err := load(ctx, p.pageIndex)
+		if err != nil {
+			p.err = err
+			return 0, false
+		}
+
+		p.pageIndex++
+		p.size = size
+		p.hasNext = hasNext
+		p.position = 0
+		p.started = true
+	}
+
+	p.position++
+
+	return p.position - 1, true
+}
+
+// pageFetcher fetches one page of documents
+type pageFetcher func(ctx context.Context, pageSize int, currentPageIndex int) (Documents, error)
+
+// QueryIterator walks a paginated result set document by document, fetching
+// the next page in the background while the current one is consumed. The prefetch
+// does not take one of the AsyncConcurrency slots, so busy futures never hold it back.
+// It is not safe for concurrent use.
+type QueryIterator struct {
+	pager
+	fetch    pageFetcher
+	page     Documents
+	prefetch *future
+	current  Document
+}
+
+func newQueryIterator(pageSize int, fetch pageFetcher) *QueryIterator {
+	return &QueryIterator{
+		pager: newPager(pageSize),
+		fetch: fetch,
+	}
+}
+
+// Next moves to the next document, returning false once all pages have been read or on error
+func (it *QueryIterator) Next(ctx context.Context) bool {
+	position, ok := it.next(ctx, func(ctx context.Context, pageIndex int) (int, bool, error) {
+		page, err := it.nextPage(ctx, pageIndex)
+		if err != nil {
+			return 0, false, err
+		}
+		it.page = page
+		return len(page.Documents), page.IsNextPageAvailable, nil
+	})
+	if !ok {
+		return false
+	}
+
+	it.current = it.page.Documents[position]
+
+	return true
+}
+
+// Document returns the current document
+func (it *QueryIterator) Document() Document {
+	return it.current
+}
+
+// Page returns the page holding the current document
+func (it *QueryIterator) Page() Documents {
+	return it.page
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *QueryIterator) Err() error {
+	return it.err
+}
+
+func (it *QueryIterator) nextPage(ctx context.Context, pageIndex int) (Documents, error) {
+	var page Documents
+	var err error
+
+	if it.prefetch != nil {
+		value, prefetchErr := it.prefetch.await(ctx)
+		it.prefetch = nil
+		page, _ = value.(Documents)
+		err = prefetchErr
+		// The prefetch was bound to the context of the previous call, retry with the current one
+		if ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			page, err = it.fetch(ctx, it.pageSize, pageIndex)
+		}
+	} else {
+		page, err = it.fetch(ctx, it.pageSize, pageIndex)
+	}
+
+	if err == nil && page.IsNextPageAvailable {
+		next := pageIndex + 1
+		it.prefetch = background(func() (interface{}, error) {
+			return it.fetch(ctx, it.pageSize, next)
+		})
+	}
+
+	return page, err
+}
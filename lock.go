@@ -0,0 +1,97 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"time"
+)
+
+// unlockTimeout bounds the unlock of WithLock, which cannot use the context of the caller
+var unlockTimeout = 30 * time.Second
+
+// fetchLock asks the server to return the lock owner and creation date with documents
+var fetchLock = map[string]string{
+	"fetch.document": "lock",
+}
+
+// Lock locks the document for the current user
+func (doc Document) Lock(ctx context.Context) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.Lock").Input(doc.input()).Headers(fetchLock).DocExecute(ctx)
+}
+
+// Unlock releases the lock of the document
+func (doc Document) Unlock(ctx context.Context) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.Unlock").Input(doc.input()).Headers(fetchLock).DocExecute(ctx)
+}
+
+// FetchLockStatus refetches the document with its lock owner and creation date
+func (doc Document) FetchLockStatus(ctx context.Context) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	url := doc.nuxeoClient.documentURL(doc)
+
+	resp, err := doc.nuxeoClient.request(ctx).SetHeaders(fetchLock).Get(url)
+
+	var currentDoc Document
+	err = HandleResponse(err, resp, &currentDoc)
+
+	currentDoc.nuxeoClient = doc.nuxeoClient
+
+	return currentDoc, err
+}
+
+// IsLocked reports whether the document was locked when fetched with its lock status
+func (doc Document) IsLocked() bool {
+	return doc.LockOwner != ""
+}
+
+// WithLock locks doc, runs fn with the locked document and always unlocks it afterwards,
+// even when fn fails or ctx is done, giving up on the unlock after 30 seconds.
+// The error of fn takes precedence over the unlock one.
+func (nuxeoClient *nuxeoClient) WithLock(ctx context.Context, doc Document, fn func(Document) error) (err error) {
+	doc.nuxeoClient = nuxeoClient
+
+	locked, err := doc.Lock(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// The lock must be released even if ctx has been cancelled meanwhile, without waiting forever for the server
+		unlockCtx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+		_, unlockErr := locked.Unlock(unlockCtx)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return fn(locked)
+}
@@ -0,0 +1,292 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The nuxeo struct tag maps a field to a property xpath, such as `nuxeo:"dc:title"` or
+// `nuxeo:"file:content"`, and to the document metadata with the tags below.
+// Nested structs map complex properties, their fields being tagged with the sub property names.
+// The omitempty option, as in `nuxeo:"dc:expired,omitempty"`, leaves zero values out of DocumentFrom.
+const (
+	// TagUID maps the uid of the document
+	TagUID = "ecm:uuid"
+	// TagType maps the document type
+	TagType = "ecm:primaryType"
+	// TagName maps the name of the document
+	TagName = "ecm:name"
+	// TagPath maps the path of the document
+	TagPath = "ecm:path"
+	// TagChangeToken maps the change token, map it to keep the conflict detection on update
+	TagChangeToken = "ecm:changeToken"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// nuxeoField is a struct field with a nuxeo tag
+type nuxeoField struct {
+	xpath     string
+	omitEmpty bool
+	value     reflect.Value
+}
+
+// Unmarshal fills the struct pointed by v from the document properties and metadata,
+// according to its nuxeo tags. Properties missing from the document are left untouched.
+func (doc Document) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("nuxeo: Unmarshal expects a pointer to a struct, not %T", v)
+	}
+
+	for _, field := range nuxeoFields(rv.Elem()) {
+		var value interface{}
+		switch field.xpath {
+		case TagUID:
+			value = doc.UID
+		case TagType:
+			value = doc.Type
+		case TagName:
+			value = doc.Name
+		case TagPath:
+			value = doc.Path
+		case TagChangeToken:
+			value = doc.ChangeToken
+		default:
+			var err error
+			value, err = doc.Get(field.xpath)
+			if errors.Is(err, ErrPropertyNotFound) {
+				continue
+			}
+		}
+
+		if err := decodeProperty(value, field.value); err != nil {
+			return fmt.Errorf("nuxeo: cannot unmarshal %s: %w", field.xpath, err)
+		}
+	}
+
+	return nil
+}
+
+// Unmarshal fills the slice pointed by v with one struct, or pointer to struct, per document of the page
+func (records Documents) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("nuxeo: Unmarshal expects a pointer to a slice, not %T", v)
+	}
+
+	slice := reflect.MakeSlice(rv.Elem().Type(), len(records.Documents), len(records.Documents))
+
+	for i, doc := range records.Documents {
+		item := slice.Index(i)
+		if item.Kind() == reflect.Ptr {
+			item.Set(reflect.New(item.Type().Elem()))
+		} else {
+			item = item.Addr()
+		}
+		if err := doc.Unmarshal(item.Interface()); err != nil {
+			return err
+		}
+	}
+
+	rv.Elem().Set(slice)
+
+	return nil
+}
+
+// DocumentFrom builds a document from a struct, or pointer to struct, according to its nuxeo tags.
+// The mapped properties are marked as changed so that UpdateDocument only sends them.
+func DocumentFrom(v interface{}) (Document, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+
+	if rv.Kind() != reflect.Struct {
+		return Document{}, fmt.Errorf("nuxeo: DocumentFrom expects a struct, not %T", v)
+	}
+
+	doc := NewDocument("", "")
+
+	for _, field := range nuxeoFields(rv) {
+		if field.omitEmpty && field.value.IsZero() {
+			continue
+		}
+
+		value := encodeProperty(field.value)
+
+		switch field.xpath {
+		case TagUID:
+			doc.UID, _ = value.(string)
+		case TagType:
+			doc.Type, _ = value.(string)
+		case TagName:
+			doc.Name, _ = value.(string)
+		case TagPath:
+			doc.Path, _ = value.(string)
+		case TagChangeToken:
+			doc.ChangeToken, _ = value.(string)
+		default:
+			if err := doc.Set(field.xpath, value); err != nil {
+				return Document{}, err
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// nuxeoFields lists the tagged fields of the struct rv, embedded structs included
+func nuxeoFields(rv reflect.Value) []nuxeoField {
+	var fields []nuxeoField
+
+	for i := 0; i < rv.NumField(); i++ {
+		structField := rv.Type().Field(i)
+		tag, tagged := structField.Tag.Lookup("nuxeo")
+
+		if structField.Anonymous && !tagged && structField.Type.Kind() == reflect.Struct {
+			fields = append(fields, nuxeoFields(rv.Field(i))...)
+			continue
+		}
+
+		if !tagged || tag == "-" || structField.PkgPath != "" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		fields = append(fields, nuxeoField{
+			xpath:     options[0],
+			omitEmpty: len(options) > 1 && options[1] == "omitempty",
+			value:     rv.Field(i),
+		})
+	}
+
+	return fields
+}
+
+// hasNuxeoFields reports whether t is a struct mapped with nuxeo tags, other structs go through encoding/json
+func hasNuxeoFields(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("nuxeo"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isMapped reports whether values of type t, or pointed by t, need a conversion from or to properties
+func isMapped(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == timeType || hasNuxeoFields(t)
+}
+
+// decodeProperty stores the property value into field
+func decodeProperty(value interface{}, field reflect.Value) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	switch {
+	case field.Kind() == reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := decodeProperty(value, elem.Elem()); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+
+	case field.Type() == timeType:
+		t, ok := parseTime(value)
+		if !ok {
+			return fmt.Errorf("%v is not a date", value)
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+
+	case hasNuxeoFields(field.Type()):
+		complexValue, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%T is not a complex property", value)
+		}
+		return Document{Properties: complexValue}.Unmarshal(field.Addr().Interface())
+
+	case field.Kind() == reflect.Slice && isMapped(field.Type().Elem()):
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%T is not a list", value)
+		}
+		slice := reflect.MakeSlice(field.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := decodeProperty(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, field.Addr().Interface())
+}
+
+// encodeProperty returns the property value of field, ready to be marshalled
+func encodeProperty(field reflect.Value) interface{} {
+	switch {
+	case field.Kind() == reflect.Ptr:
+		if field.IsNil() {
+			return nil
+		}
+		return encodeProperty(field.Elem())
+
+	case field.Type() == timeType:
+		return field.Interface().(time.Time).Format(DateLayout)
+
+	case hasNuxeoFields(field.Type()):
+		complexValue := make(map[string]interface{})
+		for _, subField := range nuxeoFields(field) {
+			if subField.omitEmpty && subField.value.IsZero() {
+				continue
+			}
+			complexValue[subField.xpath] = encodeProperty(subField.value)
+		}
+		return complexValue
+
+	case field.Kind() == reflect.Slice && isMapped(field.Type().Elem()):
+		list := make([]interface{}, field.Len())
+		for i := range list {
+			list[i] = encodeProperty(field.Index(i))
+		}
+		return list
+	}
+
+	return field.Interface()
+}
@@ -0,0 +1,135 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// NameCollisionError is returned when the target parent already has a child with the requested name
+type NameCollisionError struct {
+	Path string
+}
+
+func (e *NameCollisionError) Error() string {
+	return fmt.Sprintf("nuxeo: a document already exists at %s", e.Path)
+}
+
+// Is makes the collision match ErrConflict
+func (e *NameCollisionError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// TargetNotFoundError is returned when the target parent of a move or a copy does not exist
+type TargetNotFoundError struct {
+	Path string
+	Err  error
+}
+
+func (e *TargetNotFoundError) Error() string {
+	return fmt.Sprintf("nuxeo: target %s not found: %v", e.Path, e.Err)
+}
+
+// Unwrap exposes the server error, so that IsNotFound matches
+func (e *TargetNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// MoveDocument moves doc under targetParentPath, renaming it to newName unless empty. An explicit newName
+// already taken fails with NameCollisionError, without one the server picks a free name if needed
+func (nuxeoClient *nuxeoClient) MoveDocument(ctx context.Context, doc Document, targetParentPath string, newName string) (Document, error) {
+	return nuxeoClient.moveOrCopy(ctx, "Document.Move", doc, targetParentPath, newName)
+}
+
+// CopyDocument copies doc under targetParentPath, naming the copy newName unless empty. An explicit newName
+// already taken fails with NameCollisionError, without one the server picks a free name if needed
+func (nuxeoClient *nuxeoClient) CopyDocument(ctx context.Context, doc Document, targetParentPath string, newName string) (Document, error) {
+	return nuxeoClient.moveOrCopy(ctx, "Document.Copy", doc, targetParentPath, newName)
+}
+
+// RenameDocument changes the name, and so the path, of doc within its parent
+func (nuxeoClient *nuxeoClient) RenameDocument(ctx context.Context, doc Document, newName string) (Document, error) {
+	if doc.Path == "" {
+		fetched, err := nuxeoClient.FetchDocumentByID(ctx, doc.UID)
+		if err != nil {
+			return Document{}, err
+		}
+		doc = fetched
+	}
+
+	return nuxeoClient.moveOrCopy(ctx, "Document.Move", doc, path.Dir(doc.Path), newName)
+}
+
+func (nuxeoClient *nuxeoClient) moveOrCopy(ctx context.Context, operation string, doc Document, targetParentPath string, newName string) (Document, error) {
+	params := map[string]string{
+		"target": targetParentPath,
+	}
+
+	name := newName
+	if newName != "" {
+		params["name"] = newName
+		// The server would silently pick another name on collision, an explicit name must be kept
+		if err := nuxeoClient.checkName(ctx, operation, doc, targetParentPath, newName); err != nil {
+			return Document{}, err
+		}
+	} else {
+		name = doc.Name
+	}
+
+	result, err := nuxeoClient.Automation().Operation(operation).Input(doc.input()).Parameters(params).DocExecute(ctx)
+
+	return result, nuxeoClient.moveError(ctx, err, targetParentPath, name)
+}
+
+// checkName makes sure the target parent has no other child named name
+func (nuxeoClient *nuxeoClient) checkName(ctx context.Context, operation string, doc Document, targetParentPath string, name string) error {
+	targetPath := strings.TrimSuffix(targetParentPath, "/") + "/" + name
+	existing, err := nuxeoClient.FetchDocumentByPath(ctx, targetPath)
+
+	switch {
+	case IsNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	case operation == "Document.Move" && existing.UID == doc.UID:
+		// Moving a document where it already is
+		return nil
+	}
+
+	return &NameCollisionError{Path: targetPath}
+}
+
+// moveError turns the server errors of a move or a copy into NameCollisionError and TargetNotFoundError
+func (nuxeoClient *nuxeoClient) moveError(ctx context.Context, err error, targetParentPath string, name string) error {
+	switch {
+	case err == nil:
+		return nil
+	case IsConflict(err):
+		return &NameCollisionError{Path: strings.TrimSuffix(targetParentPath, "/") + "/" + name}
+	case IsNotFound(err):
+		// Either the document or the target parent is missing
+		if _, parentErr := nuxeoClient.FetchDocumentByPath(ctx, targetParentPath); IsNotFound(parentErr) {
+			return &TargetNotFoundError{Path: targetParentPath, Err: err}
+		}
+	}
+
+	return err
+}
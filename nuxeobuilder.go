@@ -2,6 +2,7 @@ package nuxeoclient
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -22,6 +23,8 @@ type ClientBuilder interface {
 	Headers(map[string]string) ClientBuilder
 	Cookies([]*http.Cookie) ClientBuilder
 	Repository(string) ClientBuilder
+	AsyncConcurrency(int) ClientBuilder
+	Retry(RetryPolicy) ClientBuilder
 	Build() Client
 }
 
@@ -39,6 +42,8 @@ type clientBuilder struct {
 	headers     map[string]string
 	cookies     []*http.Cookie
 	repository  string
+	concurrency int
+	retry       RetryPolicy
 }
 
 // Immutable
@@ -56,6 +61,8 @@ type nuxeoClient struct {
 	cookies     []*http.Cookie
 	repository  string
 	client      *resty.Client
+	slots       chan struct{}
+	config      *config
 }
 
 func (cb *clientBuilder) URL(url string) ClientBuilder {
@@ -109,6 +116,16 @@ func (cb *clientBuilder) Cookies(cookies []*http.Cookie) ClientBuilder {
 	return cb
 }
 
+func (cb *clientBuilder) AsyncConcurrency(concurrency int) ClientBuilder {
+	cb.concurrency = concurrency
+	return cb
+}
+
+func (cb *clientBuilder) Retry(policy RetryPolicy) ClientBuilder {
+	cb.retry = policy
+	return cb
+}
+
 func (cb *clientBuilder) Debug(debug bool) ClientBuilder {
 	cb.debug = debug
 	return cb
@@ -126,12 +143,12 @@ func (cb *clientBuilder) Build() Client {
 		cb.headers["Content-Type"] = "application/json"
 	}
 
-	for i := 0; i < len(cb.schemas); i++ {
-		cb.headers["properties"] = cb.schemas[i]
+	if len(cb.schemas) > 0 {
+		cb.headers["properties"] = strings.Join(cb.schemas, ",")
 	}
 
-	for i := 0; i < len(cb.enrichers); i++ {
-		cb.headers["enrichers.document"] = cb.enrichers[i]
+	if len(cb.enrichers) > 0 {
+		cb.headers["enrichers.document"] = strings.Join(cb.enrichers, ",")
 	}
 
 	if cb.repository != "" {
@@ -142,6 +159,7 @@ func (cb *clientBuilder) Build() Client {
 	client.SetHeaders(cb.headers)
 	client.SetDebug(cb.debug)
 	client.SetTimeout(time.Duration(cb.timeout) * time.Minute)
+	cb.retry.apply(client)
 
 	if cb.token == "" {
 		client.SetBasicAuth(cb.username, cb.password)
@@ -155,10 +173,14 @@ func (cb *clientBuilder) Build() Client {
 	}
 	cb.url = url
 
+	if cb.concurrency <= 0 {
+		cb.concurrency = DefaultAsyncConcurrency
+	}
+
 	log.Debug("Nuxeo Client Builder:")
 	log.Debug(cb)
 
-	return &nuxeoClient{
+	nuxeoClient := &nuxeoClient{
 		url:        cb.url,
 		username:   cb.username,
 		password:   cb.password,
@@ -168,7 +190,11 @@ func (cb *clientBuilder) Build() Client {
 		cookies:    cb.cookies,
 		repository: cb.repository,
 		client:     client,
+		slots:      make(chan struct{}, cb.concurrency),
 	}
+	nuxeoClient.config = &config{nuxeoClient: nuxeoClient}
+
+	return nuxeoClient
 }
 
 // NuxeoClient is the Nuxeo client builder
@@ -18,10 +18,12 @@
 package nuxeoclient
 
 import (
+	"context"
 	"encoding/json"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 
@@ -35,26 +37,49 @@ const (
 
 // Client interface
 type Client interface {
-	Login() (userLogged, error)
-	FetchDocumentRoot() (document, error)
-	FetchDocumentByPath(path string) (document, error)
-	AsyncFetchDocumentByPath(path string, c chan document)
-	CreateDocument(parentPath string, input document) (document, error)
-	AsyncCreateDocument(parentPath string, input document, c chan document)
-	UpdateDocument(input document) (document, error)
-	AsyncUpdateDocument(input document, c chan document)
-	DeleteDocument(input document) error
-	QueryWithParams(query string, pageSize int, currentPageIndex int, offset int, maxResults int, sortBy string, sortOrder string, queryParams string) (recordSet, error)
-	Query(query string) (recordSet, error)
-	AsyncQuery(query string, c chan recordSet)
-	GetDirectory(directory string) (directorySet, error)
-	CreateDirectory(directoryName string, dir directory) (directory, error)
-	DeleteDirectory(directoryName string, entry string) error
-	Attack(uri string, body []byte, method string) ([]byte, error)
+	Login(ctx context.Context) (CurrentUser, error)
+	FetchDocumentRoot(ctx context.Context) (Document, error)
+	FetchDocumentByPath(ctx context.Context, path string) (Document, error)
+	FetchDocumentByID(ctx context.Context, uid string) (Document, error)
+	AsyncFetchDocumentByPath(ctx context.Context, path string) DocumentFuture
+	CreateDocument(ctx context.Context, parentPath string, input Document) (Document, error)
+	AsyncCreateDocument(ctx context.Context, parentPath string, input Document) DocumentFuture
+	UpdateDocument(ctx context.Context, input Document, options ...UpdateOption) (Document, error)
+	AsyncUpdateDocument(ctx context.Context, input Document, options ...UpdateOption) DocumentFuture
+	DeleteDocument(ctx context.Context, input Document) error
+	MoveDocument(ctx context.Context, doc Document, targetParentPath string, newName string) (Document, error)
+	CopyDocument(ctx context.Context, doc Document, targetParentPath string, newName string) (Document, error)
+	RenameDocument(ctx context.Context, doc Document, newName string) (Document, error)
+	TrashDocument(ctx context.Context, doc Document) (Document, error)
+	UntrashDocument(ctx context.Context, doc Document) (Document, error)
+	EmptyTrash(ctx context.Context, parent Document) error
+	WithLock(ctx context.Context, doc Document, fn func(Document) error) error
+	RetryOnConflict(ctx context.Context, fetch func(context.Context) (Document, error), mutate func(*Document) error, options ...UpdateOption) (Document, error)
+	QueryWithParams(ctx context.Context, query string, pageSize int, currentPageIndex int, offset int, maxResults int, sortBy string, sortOrder string, queryParams string) (Documents, error)
+	Query(ctx context.Context, query string) (Documents, error)
+	QueryIterator(query string, pageSize int) *QueryIterator
+	AsyncQuery(ctx context.Context, query string) DocumentsFuture
+	FindByTag(tag string, pageSize int) *QueryIterator
+	AuditQuery(options AuditOptions) *AuditIterator
+	StartWorkflow(ctx context.Context, doc Document, modelName string, variables map[string]interface{}) (Workflow, error)
+	ListWorkflows(ctx context.Context, doc Document) ([]Workflow, error)
+	CancelWorkflow(ctx context.Context, workflow Workflow) error
+	ListTasks(ctx context.Context, filter TaskFilter) ([]Task, error)
+	DelegateTask(ctx context.Context, task Task, actors []string, comment string) (Task, error)
+	ReassignTask(ctx context.Context, task Task, actors []string, comment string) (Task, error)
+	CompleteTask(ctx context.Context, task Task, action string, variables map[string]interface{}, comment string) (Task, error)
+	GetDirectory(ctx context.Context, name string) (DirectoryEntries, error)
+	CreateDirectory(ctx context.Context, directoryName string, dir DirectoryEntry) (DirectoryEntry, error)
+	DeleteDirectory(ctx context.Context, directoryName string, entry string) error
+	Attack(ctx context.Context, uri string, body []byte, method string) ([]byte, error)
 	Automation() Automation
-	GetUser(username string) (user, error)
-	DeleteUser(username string) error
-	CreateUser(newUser user) (user, error)
+	BatchUpload(ctx context.Context) (*Batch, error)
+	Batch(batchID string) *Batch
+	QueryBuilder() QueryBuilder
+	Config() Config
+	GetUser(ctx context.Context, username string) (User, error)
+	DeleteUser(ctx context.Context, username string) error
+	CreateUser(ctx context.Context, newUser User) (User, error)
 }
 
 func init() {
@@ -72,156 +97,140 @@ func init() {
 }
 
 // Create the client after applying configuration
-func (nuxeoClient *nuxeoClient) Login() (userLogged, error) {
+func (nuxeoClient *nuxeoClient) Login(ctx context.Context) (CurrentUser, error) {
 
 	url := nuxeoClient.url + "/api/v1/automation/login"
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Post(url)
+	resp, err := nuxeoClient.request(ctx).Post(url)
 
-	var currentUser userLogged
+	var currentUser CurrentUser
 	err = HandleResponse(err, resp, &currentUser)
 
 	return currentUser, err
 }
 
-func (nuxeoClient *nuxeoClient) FetchDocumentRoot() (document, error) {
+func (nuxeoClient *nuxeoClient) FetchDocumentRoot(ctx context.Context) (Document, error) {
 
 	url := nuxeoClient.url + "/api/v1/path//"
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Get(url)
+	resp, err := nuxeoClient.request(ctx).Get(url)
 
-	var currentDoc document
+	var currentDoc Document
 	err = HandleResponse(err, resp, &currentDoc)
 
 	// Attach client to document
-	currentDoc.nuxeoClient = *nuxeoClient
+	currentDoc.nuxeoClient = nuxeoClient
 
 	return currentDoc, err
 }
 
-func (nuxeoClient *nuxeoClient) FetchDocumentByPath(path string) (document, error) {
+func (nuxeoClient *nuxeoClient) FetchDocumentByPath(ctx context.Context, path string) (Document, error) {
 
-	url := nuxeoClient.url + "/api/v1/path" + path
+	url := nuxeoClient.pathURL(path)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Get(url)
+	resp, err := nuxeoClient.request(ctx).Get(url)
 
-	var currentDoc document
+	var currentDoc Document
 	err = HandleResponse(err, resp, &currentDoc)
 
-	currentDoc.nuxeoClient = *nuxeoClient
+	currentDoc.nuxeoClient = nuxeoClient
 
 	return currentDoc, err
 }
 
-func (nuxeoClient *nuxeoClient) AsyncFetchDocumentByPath(path string, c chan document) {
+func (nuxeoClient *nuxeoClient) FetchDocumentByID(ctx context.Context, uid string) (Document, error) {
 
-	url := nuxeoClient.url + "/api/v1/path" + path
+	url := nuxeoClient.idURL(uid)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Get(url)
+	resp, err := nuxeoClient.request(ctx).Get(url)
 
-	var currentDoc document
+	var currentDoc Document
 	err = HandleResponse(err, resp, &currentDoc)
 
-	if err != nil {
-		panic(err)
-	}
+	currentDoc.nuxeoClient = nuxeoClient
 
-	currentDoc.nuxeoClient = *nuxeoClient
+	return currentDoc, err
+}
 
-	c <- currentDoc
+func (nuxeoClient *nuxeoClient) AsyncFetchDocumentByPath(ctx context.Context, path string) DocumentFuture {
+	return DocumentFuture{nuxeoClient.async(ctx, func() (interface{}, error) {
+		return nuxeoClient.FetchDocumentByPath(ctx, path)
+	})}
 }
 
-func (nuxeoClient *nuxeoClient) CreateDocument(parentPath string, input document) (document, error) {
-	url := nuxeoClient.url + "/api/v1/path" + parentPath
+func (nuxeoClient *nuxeoClient) CreateDocument(ctx context.Context, parentPath string, input Document) (Document, error) {
+	url := nuxeoClient.pathURL(parentPath)
 
 	body, err := json.Marshal(input)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Post(url)
+	resp, err := nuxeoClient.request(ctx).SetBody(string(body[:])).Post(url)
 
-	var currentDoc document
+	var currentDoc Document
 	err = HandleResponse(err, resp, &currentDoc)
 
-	currentDoc.nuxeoClient = *nuxeoClient
+	currentDoc.nuxeoClient = nuxeoClient
 
 	return currentDoc, err
 }
 
-func (nuxeoClient *nuxeoClient) AsyncCreateDocument(parentPath string, input document, c chan document) {
-	url := nuxeoClient.url + "/api/v1/path" + parentPath
-
-	body, err := json.Marshal(input)
-
-	resp, err := nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Post(url)
-
-	var currentDoc document
-	err = HandleResponse(err, resp, &currentDoc)
-
-	if err != nil {
-		panic(err)
-	}
-
-	currentDoc.nuxeoClient = *nuxeoClient
-
-	c <- currentDoc
+func (nuxeoClient *nuxeoClient) AsyncCreateDocument(ctx context.Context, parentPath string, input Document) DocumentFuture {
+	return DocumentFuture{nuxeoClient.async(ctx, func() (interface{}, error) {
+		return nuxeoClient.CreateDocument(ctx, parentPath, input)
+	})}
 }
 
-func (nuxeoClient *nuxeoClient) UpdateDocument(input document) (document, error) {
-	url := nuxeoClient.url + "/api/v1/path" + input.Path
+// UpdateDocument saves input, sending only the properties changed since it was fetched.
+// The server rejects the update with a ConflictError when the change token of input is stale
+func (nuxeoClient *nuxeoClient) UpdateDocument(ctx context.Context, input Document, options ...UpdateOption) (Document, error) {
+	url := nuxeoClient.documentURL(input)
 
-	body, err := json.Marshal(input)
+	updateOptions := newUpdateOptions(options)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Put(url)
+	body, err := input.updateBody()
 
-	var currentDoc document
-	err = HandleResponse(err, resp, &currentDoc)
+	resp, err := nuxeoClient.request(ctx).SetHeaders(updateOptions.headers).SetBody(string(body[:])).Put(url)
+
+	var currentDoc Document
+	err = newConflictError(HandleResponse(err, resp, &currentDoc), input)
 
-	currentDoc.nuxeoClient = *nuxeoClient
+	currentDoc.nuxeoClient = nuxeoClient
 
 	return currentDoc, err
 }
 
-func (nuxeoClient *nuxeoClient) AsyncUpdateDocument(input document, c chan document) {
-	url := nuxeoClient.url + "/api/v1/path" + input.Path
-
-	body, err := json.Marshal(input)
-
-	resp, err := nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Put(url)
-
-	var currentDoc document
-	err = HandleResponse(err, resp, &currentDoc)
-
-	if err != nil {
-		panic(err)
-	}
-
-	currentDoc.nuxeoClient = *nuxeoClient
-
-	c <- currentDoc
+func (nuxeoClient *nuxeoClient) AsyncUpdateDocument(ctx context.Context, input Document, options ...UpdateOption) DocumentFuture {
+	return DocumentFuture{nuxeoClient.async(ctx, func() (interface{}, error) {
+		return nuxeoClient.UpdateDocument(ctx, input, options...)
+	})}
 }
 
-func (nuxeoClient *nuxeoClient) DeleteDocument(input document) error {
-	url := nuxeoClient.url + "/api/v1/path" + input.Path
+func (nuxeoClient *nuxeoClient) DeleteDocument(ctx context.Context, input Document) error {
+	url := nuxeoClient.documentURL(input)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Delete(url)
+	resp, err := nuxeoClient.request(ctx).Delete(url)
 
 	err = HandleResponse(err, resp, nil)
 	return err
 }
 
-func (nuxeoClient *nuxeoClient) Query(query string) (recordSet, error) {
-	return nuxeoClient.QueryWithParams(query, 0, 0, 0, 0, "", "", "")
+func (nuxeoClient *nuxeoClient) Query(ctx context.Context, query string) (Documents, error) {
+	return nuxeoClient.QueryWithParams(ctx, query, 0, 0, 0, 0, "", "", "")
 }
 
-func (nuxeoClient *nuxeoClient) AsyncQuery(query string, c chan recordSet) {
-	recordSet, err := nuxeoClient.QueryWithParams(query, 0, 0, 0, 0, "", "", "")
+// QueryIterator walks all the results of the query, pageSize at a time
+func (nuxeoClient *nuxeoClient) QueryIterator(query string, pageSize int) *QueryIterator {
+	return newQueryIterator(pageSize, func(ctx context.Context, pageSize int, currentPageIndex int) (Documents, error) {
+		return nuxeoClient.QueryWithParams(ctx, query, pageSize, currentPageIndex, 0, 0, "", "", "")
+	})
+}
 
-	if err != nil {
-		panic(err)
-	}
-	c <- recordSet
+func (nuxeoClient *nuxeoClient) AsyncQuery(ctx context.Context, query string) DocumentsFuture {
+	return DocumentsFuture{nuxeoClient.async(ctx, func() (interface{}, error) {
+		return nuxeoClient.Query(ctx, query)
+	})}
 }
 
-func (nuxeoClient *nuxeoClient) QueryWithParams(query string, pageSize int, currentPageIndex int, offset int, maxResults int, sortBy string, sortOrder string, queryParams string) (recordSet, error) {
+func (nuxeoClient *nuxeoClient) QueryWithParams(ctx context.Context, query string, pageSize int, currentPageIndex int, offset int, maxResults int, sortBy string, sortOrder string, queryParams string) (Documents, error) {
 
 	baseURL, err := url.Parse(nuxeoClient.url)
 
@@ -237,41 +246,54 @@ func (nuxeoClient *nuxeoClient) QueryWithParams(query string, pageSize int, curr
 	params.Add("offset", strconv.Itoa(offset))
 	params.Add("maxResults", strconv.Itoa(maxResults))
 	params.Add("sortBy", sortBy)
+	if sortOrder != "" {
+		params.Add("sortOrder", sortOrder)
+	}
 	if queryParams != "" {
 		params.Add("queryParams", queryParams)
 	}
 
 	baseURL.RawQuery = params.Encode()
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Get(baseURL.String())
+	resp, err := nuxeoClient.request(ctx).Get(baseURL.String())
 
-	var recordSet recordSet
-	err = HandleResponse(err, resp, &recordSet)
+	var records Documents
+	err = HandleResponse(err, resp, &records)
 
-	for key, doc := range recordSet.Documents {
-		_ = key
-		doc.nuxeoClient = *nuxeoClient
-	}
+	records.attach(nuxeoClient)
 
-	return recordSet, err
+	return records, err
 }
 
-func (nuxeoClient *nuxeoClient) Attack(uri string, body []byte, method string) ([]byte, error) {
+func (nuxeoClient *nuxeoClient) Attack(ctx context.Context, uri string, body []byte, method string) ([]byte, error) {
 	var resp *resty.Response
 	var err error
 	switch method {
 	case "get":
-		resp, err = nuxeoClient.client.R().EnableTrace().Get(uri)
+		resp, err = nuxeoClient.request(ctx).Get(uri)
 	case "post":
-		resp, err = nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Post(uri)
+		resp, err = nuxeoClient.request(ctx).SetBody(string(body[:])).Post(uri)
 	case "put":
-		resp, err = nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Put(uri)
+		resp, err = nuxeoClient.request(ctx).SetBody(string(body[:])).Put(uri)
 	case "delete":
-		resp, err = nuxeoClient.client.R().EnableTrace().Delete(uri)
+		resp, err = nuxeoClient.request(ctx).Delete(uri)
 	default:
-		resp, err = nuxeoClient.client.R().EnableTrace().Get(uri)
+		resp, err = nuxeoClient.request(ctx).Get(uri)
+	}
+	if err = checkResponse(err, resp); err != nil {
+		return nil, err
 	}
-	return resp.Body(), err
+	return resp.Body(), nil
+}
+
+func (nuxeoClient *nuxeoClient) QueryBuilder() QueryBuilder {
+	return &queryBuilder{
+		nuxeoClient: nuxeoClient,
+	}
+}
+
+func (nuxeoClient *nuxeoClient) Config() Config {
+	return nuxeoClient.config
 }
 
 func (nuxeoClient *nuxeoClient) Automation() Automation {
@@ -279,3 +301,36 @@ func (nuxeoClient *nuxeoClient) Automation() Automation {
 		nuxeoClient: nuxeoClient,
 	}
 }
+
+// request prepares a traced resty request bound to the given context
+func (nuxeoClient *nuxeoClient) request(ctx context.Context) *resty.Request {
+	return nuxeoClient.client.R().SetContext(ctx).EnableTrace()
+}
+
+// enrichersHeader adds enrichers to the ones set on the client
+func (nuxeoClient *nuxeoClient) enrichersHeader(enrichers ...string) map[string]string {
+	if configured := nuxeoClient.headers["enrichers.document"]; configured != "" {
+		enrichers = append([]string{configured}, enrichers...)
+	}
+	return map[string]string{
+		"enrichers.document": strings.Join(enrichers, ","),
+	}
+}
+
+// pathURL returns the rest api url of the document at path
+func (nuxeoClient *nuxeoClient) pathURL(path string) string {
+	return nuxeoClient.url + "/api/v1/path" + escapePath(path)
+}
+
+// idURL returns the rest api url of the document with the given uid
+func (nuxeoClient *nuxeoClient) idURL(uid string) string {
+	return nuxeoClient.url + "/api/v1/id/" + url.PathEscape(uid)
+}
+
+// documentURL returns the rest api url of doc, by uid when known since paths change on rename or move
+func (nuxeoClient *nuxeoClient) documentURL(doc Document) string {
+	if doc.UID != "" {
+		return nuxeoClient.idURL(doc.UID)
+	}
+	return nuxeoClient.pathURL(doc.Path)
+}
@@ -18,11 +18,25 @@
 package nuxeoclient
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,14 +44,16 @@ const DEBUG = false
 
 func TestSmokeClient(t *testing.T) {
 	assert := assert.New(t)
+	ctx := context.Background()
 	nuxeoClient := NuxeoClient().URL("http://localhost:8080/nuxeo").Username("Administrator").Password("Administrator").Debug(DEBUG).Build()
-	currentUser, err := nuxeoClient.Login()
+	currentUser, err := nuxeoClient.Login(ctx)
 	assert.Nil(err)
 	assert.Equal("Administrator", currentUser.Username)
 }
 
 func TestClientOptions(t *testing.T) {
 	assert := assert.New(t)
+	ctx := context.Background()
 
 	headers := map[string]string{}
 	headers["content-type"] = "application/json"
@@ -52,7 +68,7 @@ func TestClientOptions(t *testing.T) {
 	}
 
 	nuxeoClient := NuxeoClient().URL("http://localhost:8080/nuxeo").Timeout(1).Headers(headers).Cookies(cookies).Username("Administrator").Password("Administrator").Debug(DEBUG).Build()
-	currentUser, err := nuxeoClient.Login()
+	currentUser, err := nuxeoClient.Login(ctx)
 
 	assert.Nil(err)
 
@@ -60,111 +76,1603 @@ func TestClientOptions(t *testing.T) {
 	assert.True(currentUser.IsAdministrator)
 }
 
-func initTest(t *testing.T) (*assert.Assertions, Client) {
+func TestRetryPolicy(t *testing.T) {
 	assert := assert.New(t)
+	ctx := context.Background()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"entity-type":"document","path":"/"}`))
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 10 * time.Millisecond
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Username("Administrator").Password("Administrator").Debug(DEBUG).Retry(policy).Build()
+
+	doc, err := nuxeoClient.FetchDocumentByPath(ctx, "/")
+
+	assert.Nil(err)
+	assert.Equal("/", doc.Path)
+	assert.Equal(int32(3), atomic.LoadInt32(&calls))
+
+	// POST is not idempotent, it is never retried unless allowed
+	_, err = nuxeoClient.CreateDocument(ctx, "/", NewDocument("File", "file"))
+
+	assert.Equal(http.StatusServiceUnavailable, err.(*NuxeoError).Status)
+	assert.Equal(int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestRetryAfterBeyondMaxBackoff(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"entity-type":"document","path":"/"}`))
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Username("Administrator").Password("Administrator").Debug(DEBUG).Retry(policy).Build()
+
+	start := time.Now()
+	_, err := nuxeoClient.FetchDocumentByPath(ctx, "/")
+
+	assert.Nil(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+	assert.True(time.Since(start) >= time.Second)
+
+	// Longer delays than MaxRetryAfter end the retries
+	atomic.StoreInt32(&calls, 0)
+	policy.MaxRetryAfter = 500 * time.Millisecond
+	nuxeoClient = NuxeoClient().URL(server.URL).Username("Administrator").Password("Administrator").Debug(DEBUG).Retry(policy).Build()
+
+	start = time.Now()
+	_, err = nuxeoClient.FetchDocumentByPath(ctx, "/")
+
+	assert.Equal(http.StatusServiceUnavailable, err.(*NuxeoError).Status)
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+	assert.True(time.Since(start) < time.Second)
+}
+
+func TestRetryKeepsLastResponse(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"entity-type":"exception","status":503,"message":"Repository is down"}`))
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 3
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+
+	doc := Document{UID: "1", nuxeoClient: NuxeoClient().URL(server.URL).Debug(DEBUG).Retry(policy).Build().(*nuxeoClient)}
+
+	_, err := doc.OpenBlob(ctx, "file:content")
+
+	assert.Equal(int32(3), atomic.LoadInt32(&calls))
+	assert.Equal("Repository is down", err.(*NuxeoError).Message)
+}
+
+func TestRetryOnConflict(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var token, puts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var doc Document
+			json.NewDecoder(r.Body).Decode(&doc)
+			// The first write races with another writer
+			if atomic.AddInt32(&puts, 1) == 1 {
+				atomic.AddInt32(&token, 1)
+			}
+			if doc.ChangeToken != strconv.Itoa(int(atomic.LoadInt32(&token))) {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"entity-type":"exception","status":409,"message":"Cannot save, document was modified"}`))
+				return
+			}
+			doc.ChangeToken = strconv.Itoa(int(atomic.AddInt32(&token, 1)))
+			json.NewEncoder(w).Encode(doc)
+			return
+		}
+		fmt.Fprintf(w, `{"entity-type":"document","uid":"1","path":"/file","changeToken":"%d","properties":{}}`, atomic.LoadInt32(&token))
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Username("Administrator").Password("Administrator").Debug(DEBUG).Build()
+
+	stale, err := nuxeoClient.FetchDocumentByID(ctx, "1")
+	assert.Nil(err)
+	atomic.AddInt32(&token, 1)
+
+	_, err = nuxeoClient.UpdateDocument(ctx, stale)
+
+	var conflictErr *ConflictError
+	assert.True(errors.As(err, &conflictErr))
+	assert.True(IsConflict(err))
+	assert.Equal("1", conflictErr.UID)
+	assert.Equal("0", conflictErr.ChangeToken)
+
+	atomic.StoreInt32(&puts, 0)
+	fetches := 0
+	updated, err := nuxeoClient.RetryOnConflict(ctx, func(ctx context.Context) (Document, error) {
+		fetches++
+		return nuxeoClient.FetchDocumentByID(ctx, "1")
+	}, func(doc *Document) error {
+		doc.Properties["dc:title"] = "updated"
+		return nil
+	})
+
+	assert.Nil(err)
+	assert.Equal(2, fetches)
+	assert.Equal("updated", updated.Properties["dc:title"])
+}
+
+func TestConfig(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/api/v1/config/types":
+			w.Write([]byte(`{"doctypes":{"File":{"parent":"Document","facets":["Downloadable"],"schemas":["dublincore",{"name":"files"}]}}}`))
+		case "/api/v1/config/schemas":
+			w.Write([]byte(`[{"name":"dublincore","@prefix":"dc","fields":{"title":"string","subjects":"string[]","created":"date"}},
+				{"name":"files","@prefix":"files","fields":{"files":{"type":"complex[]","fields":{"file":"blob","filename":"string"}}}}]`))
+		case "/api/v1/config/facets":
+			w.Write([]byte(`[{"name":"Downloadable","schemas":[{"name":"files","@prefix":"files"}]}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := NuxeoClient().URL(server.URL).Debug(DEBUG).Build().Config()
+
+	docType, err := config.Type(ctx, "File")
+
+	assert.Nil(err)
+	assert.Equal("File", docType.Name)
+	assert.Equal("Document", docType.Parent)
+	assert.Equal([]string{"dublincore", "files"}, docType.Schemas)
+
+	_, err = config.Type(ctx, "Folder")
+	assert.True(IsNotFound(err))
+
+	schema, err := config.Schema(ctx, "files")
+
+	assert.Nil(err)
+	assert.Equal("files", schema.XPathPrefix())
+	assert.Equal(Field{Type: "complex", Multiple: true, Fields: map[string]Field{"file": {Type: "blob"}, "filename": {Type: "string"}}}, schema.Fields["files"])
+
+	facet, err := config.Facet(ctx, "Downloadable")
+
+	assert.Nil(err)
+	assert.Equal([]string{"files"}, facet.Schemas)
+	assert.Equal(int32(3), atomic.LoadInt32(&calls))
+
+	doc := NewDocument("File", "file")
+	doc.Set("dc:title", "title")
+	doc.Set("dc:subjects", []string{"art"})
+	doc.SetTime("dc:created", time.Now())
+	doc.Set("files:files/0/file", BatchBlob{BatchID: "batch", FileIdx: "0"})
+
+	assert.Nil(config.Validate(ctx, doc))
+
+	doc.Set("dc:title", 42)
+	assert.True(errors.Is(config.Validate(ctx, doc), ErrInvalidProperty))
+
+	doc.Set("dc:title", "title")
+	doc.Set("files:files/0/size", 42)
+	assert.True(errors.Is(config.Validate(ctx, doc), ErrInvalidProperty))
+
+	doc = NewDocument("File", "file")
+	doc.Set("note:note", "note")
+	assert.True(errors.Is(config.Validate(ctx, doc), ErrInvalidProperty))
+
+	// Everything has been served from the cache
+	assert.Equal(int32(3), atomic.LoadInt32(&calls))
+
+	config.Invalidate()
+	_, err = config.Types(ctx)
+	assert.Nil(err)
+	assert.Equal(int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestConfigCacheIsolation(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	fetching, slow := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/config/types":
+			close(fetching)
+			<-slow
+			w.Write([]byte(`{"doctypes":{"File":{"schemas":["dublincore"]}}}`))
+		case "/api/v1/config/schemas":
+			w.Write([]byte(`[{"name":"dublincore","@prefix":"dc","fields":{"title":"string"}}]`))
+		}
+	}))
+	defer server.Close()
+
+	config := NuxeoClient().URL(server.URL).Debug(DEBUG).Build().Config()
+
+	// A slow fetch does not block the other definitions
+	types := make(chan error)
+	go func() {
+		_, err := config.Types(ctx)
+		types <- err
+	}()
+	<-fetching
+
+	schemas, err := config.Schemas(ctx)
+	assert.Nil(err)
+	close(slow)
+	assert.Nil(<-types)
+
+	// Callers get copies of the cache
+	delete(schemas["dublincore"].Fields, "title")
+	docType, _ := config.Type(ctx, "File")
+	docType.Schemas[0] = "changed"
+
+	schema, _ := config.Schema(ctx, "dublincore")
+	assert.Contains(schema.Fields, "title")
+	docType, _ = config.Type(ctx, "File")
+	assert.Equal([]string{"dublincore"}, docType.Schemas)
+}
+
+func initTest(t *testing.T) (*assert.Assertions, Client, context.Context) {
+	assert := assert.New(t)
+	ctx := context.Background()
 
 	nuxeoClient := NuxeoClient().URL("http://localhost:8080/nuxeo").Username("Administrator").Password("Administrator").Debug(DEBUG).Schemas([]string{"*"}).Build()
 
-	nuxeoClient.Login()
-	return assert, nuxeoClient
+	nuxeoClient.Login(ctx)
+	return assert, nuxeoClient, ctx
+}
+
+func TestRepositoryFetch(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	rootDocument, err := nuxeoClient.FetchDocumentRoot(ctx)
+
+	assert.Nil(err)
+
+	assert.Equal("/", rootDocument.Path)
+
+	domain, err := nuxeoClient.FetchDocumentByPath(ctx, "/default-domain")
+
+	assert.Nil(err)
+
+	assert.Equal("/default-domain", domain.Path)
+
+	documents, err := domain.FetchChildren(ctx)
+
+	assert.Nil(err)
+	assert.Equal(3, len(documents.Documents))
+}
+
+func TestAsyncFunctions(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	future := nuxeoClient.AsyncFetchDocumentByPath(ctx, "/default-domain")
+
+	awaitCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	rootDocument, err := future.Await(awaitCtx)
+
+	assert.Nil(err)
+	assert.Equal("/default-domain", rootDocument.Path)
+
+	missing, err := nuxeoClient.AsyncFetchDocumentByPath(ctx, "/default-domain/does-not-exist").Await(ctx)
+
+	assert.True(IsNotFound(err))
+	assert.Empty(missing.Path)
+}
+
+func TestAsyncFanOut(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	nuxeoClient := NuxeoClient().URL("http://localhost:8080/nuxeo").Username("Administrator").Password("Administrator").Debug(DEBUG).AsyncConcurrency(2).Build()
+
+	paths := []string{"/default-domain", "/default-domain/workspaces", "/default-domain/sections", "/default-domain/templates"}
+
+	futures := make([]DocumentFuture, len(paths))
+	for i, path := range paths {
+		futures[i] = nuxeoClient.AsyncFetchDocumentByPath(ctx, path)
+	}
+
+	for i, future := range futures {
+		doc, err := future.Await(ctx)
+		assert.Nil(err)
+		assert.Equal(paths[i], doc.Path)
+	}
+}
+
+func TestAsyncCancellation(t *testing.T) {
+	assert, nuxeoClient, _ := initTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := nuxeoClient.AsyncQuery(ctx, "SELECT * FROM Domain").Await(context.Background())
+
+	assert.True(errors.Is(err, context.Canceled))
+}
+
+func TestContextCancellation(t *testing.T) {
+	assert, nuxeoClient, _ := initTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := nuxeoClient.FetchDocumentByPath(ctx, "/default-domain")
+
+	assert.True(errors.Is(err, context.Canceled))
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	workspaces, err := nuxeoClient.FetchDocumentByPath(ctx, "/nuxeo")
+
+	if err != nil {
+		assert.Fail("call error")
+	}
+
+	newDocument := NewDocument("File", "new_file_with_go")
+	newDocument.Properties["dc:title"] = "New Document"
+
+	newDocument, err = nuxeoClient.CreateDocument(ctx, workspaces.Path, newDocument)
+
+	assert.Nil(err)
+
+	assert.NotNil(newDocument.UID)
+	assert.Equal("/nuxeo/new_file_with_go", newDocument.Path)
+	assert.Equal("New Document", newDocument.Properties["dc:title"])
+
+	fetchedDocument, err := nuxeoClient.FetchDocumentByID(ctx, newDocument.UID)
+
+	assert.Nil(err)
+	assert.Equal(newDocument.Path, fetchedDocument.Path)
+
+	newDocument.Properties["dc:title"] = "Document Updated"
+	updatedDocument, err := nuxeoClient.UpdateDocument(ctx, newDocument)
+
+	assert.Nil(err)
+
+	assert.Equal("Document Updated", updatedDocument.Properties["dc:title"])
+
+	err = nuxeoClient.DeleteDocument(ctx, updatedDocument)
+	assert.Nil(err)
+
+	updatedDocument, err = nuxeoClient.FetchDocumentByPath(ctx, updatedDocument.Path)
+	if err == nil {
+		assert.Fail("This document should not be found")
+	}
+}
+
+func TestMoveCopyRename(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	source, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("Folder", "move_source_with_go"))
+	assert.Nil(err)
+	target, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("Folder", "move_target_with_go"))
+	assert.Nil(err)
+	file, err := nuxeoClient.CreateDocument(ctx, source.Path, NewDocument("File", "file"))
+	assert.Nil(err)
+
+	copied, err := nuxeoClient.CopyDocument(ctx, file, target.Path, "")
+	assert.Nil(err)
+	assert.Equal(target.Path+"/file", copied.Path)
+	assert.NotEqual(file.UID, copied.UID)
+
+	_, err = nuxeoClient.MoveDocument(ctx, file, target.Path, "file")
+	var collision *NameCollisionError
+	assert.True(errors.As(err, &collision))
+	assert.True(IsConflict(err))
+
+	moved, err := nuxeoClient.MoveDocument(ctx, file, target.Path, "moved")
+	assert.Nil(err)
+	assert.Equal(target.Path+"/moved", moved.Path)
+	assert.Equal(file.UID, moved.UID)
+
+	renamed, err := nuxeoClient.RenameDocument(ctx, Document{UID: moved.UID}, "renamed")
+	assert.Nil(err)
+	assert.Equal(target.Path+"/renamed", renamed.Path)
+
+	_, err = nuxeoClient.MoveDocument(ctx, renamed, "/default-domain/missing", "")
+	var notFound *TargetNotFoundError
+	assert.True(errors.As(err, &notFound))
+	assert.True(IsNotFound(err))
+
+	assert.Nil(nuxeoClient.DeleteDocument(ctx, source))
+	assert.Nil(nuxeoClient.DeleteDocument(ctx, target))
+}
+
+func TestMoveTargetChecks(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var moves, copies, fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/path/target", "/api/v1/path/target/taken":
+			atomic.AddInt32(&fetches, 1)
+			w.Write([]byte(`{"entity-type":"document","uid":"other"}`))
+		case "/site/automation/Document.Move":
+			atomic.AddInt32(&moves, 1)
+			body, _ := ioutil.ReadAll(r.Body)
+			if strings.Contains(string(body), "/missing") {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"entity-type":"exception","status":404,"message":"/missing"}`))
+				return
+			}
+			w.Write([]byte(`{"entity-type":"document","uid":"1","path":"/target/free","name":"free"}`))
+		case "/site/automation/Document.Copy":
+			atomic.AddInt32(&copies, 1)
+			w.Write([]byte(`{"entity-type":"document","uid":"2","path":"/source/taken.1","name":"taken.1"}`))
+		default:
+			atomic.AddInt32(&fetches, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build()
+	doc := Document{UID: "1", Path: "/source/taken", Name: "taken"}
+
+	// Nothing is checked without an explicit name, the server picks a free one
+	copied, err := nuxeoClient.CopyDocument(ctx, doc, "/source", "")
+	assert.Nil(err)
+	assert.Equal("taken.1", copied.Name)
+	assert.Equal(int32(0), atomic.LoadInt32(&fetches))
+
+	_, err = nuxeoClient.MoveDocument(ctx, doc, "/missing", "")
+	var notFound *TargetNotFoundError
+	assert.True(errors.As(err, &notFound))
+	assert.True(IsNotFound(err))
+
+	_, err = nuxeoClient.MoveDocument(ctx, doc, "/target", "taken")
+	assert.Equal(&NameCollisionError{Path: "/target/taken"}, err)
+	assert.Equal(int32(1), atomic.LoadInt32(&moves))
+
+	moved, err := nuxeoClient.MoveDocument(ctx, doc, "/target", "free")
+	assert.Nil(err)
+	assert.Equal("/target/free", moved.Path)
+	assert.Equal(int32(2), atomic.LoadInt32(&moves))
+	assert.Equal(int32(1), atomic.LoadInt32(&copies))
+}
+
+func TestTrash(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	parent, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("Folder", "trash_folder_with_go"))
+	assert.Nil(err)
+	file, err := nuxeoClient.CreateDocument(ctx, parent.Path, NewDocument("File", "trash_file_with_go"))
+	assert.Nil(err)
+	assert.False(file.IsTrashed)
+
+	trashed, err := nuxeoClient.TrashDocument(ctx, file)
+	assert.Nil(err)
+	assert.True(trashed.IsTrashed)
+
+	records, err := nuxeoClient.QueryBuilder().StartsWith(parent.Path).Trashed().Execute(ctx)
+	assert.Nil(err)
+	assert.Equal(1, len(records.Documents))
+
+	untrashed, err := nuxeoClient.UntrashDocument(ctx, trashed)
+	assert.Nil(err)
+	assert.False(untrashed.IsTrashed)
+
+	_, err = nuxeoClient.TrashDocument(ctx, untrashed)
+	assert.Nil(err)
+
+	assert.Nil(nuxeoClient.EmptyTrash(ctx, parent))
+
+	_, err = nuxeoClient.FetchDocumentByID(ctx, file.UID)
+	assert.True(IsNotFound(err))
+
+	assert.Nil(nuxeoClient.DeleteDocument(ctx, parent))
+}
+
+func TestTags(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	file, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("File", "tags_file_with_go"))
+	assert.Nil(err)
+
+	_, err = file.AddTags(ctx, "gotag1", "gotag2")
+	assert.Nil(err)
+
+	tags, err := file.Tags(ctx)
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"gotag1", "gotag2"}, tags)
+
+	_, err = file.RemoveTags(ctx, "gotag2")
+	assert.Nil(err)
+
+	tags, err = file.Tags(ctx)
+	assert.Nil(err)
+	assert.Equal([]string{"gotag1"}, tags)
+
+	it := nuxeoClient.FindByTag("gotag1", 10)
+	found := false
+	for it.Next(ctx) {
+		found = found || it.Document().UID == file.UID
+	}
+	assert.Nil(it.Err())
+	assert.True(found)
+
+	assert.Nil(nuxeoClient.DeleteDocument(ctx, file))
+}
+
+func TestComments(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	file, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("File", "comments_file_with_go"))
+	assert.Nil(err)
+
+	comment, err := file.CreateComment(ctx, NewComment("first"))
+	assert.Nil(err)
+	assert.Equal(file.UID, comment.ParentID)
+	assert.Equal("Administrator", comment.Author)
+
+	reply, err := comment.Reply(ctx, NewComment("reply"))
+	assert.Nil(err)
+	_, err = reply.Reply(ctx, NewComment("reply to reply"))
+	assert.Nil(err)
+
+	comment.Text = "first updated"
+	comment, err = file.UpdateComment(ctx, comment)
+	assert.Nil(err)
+	assert.Equal("first updated", comment.Text)
+
+	comments, err := file.FetchComments(ctx, 10, 0)
+	assert.Nil(err)
+	assert.Equal(1, len(comments.Comments))
+
+	var texts []string
+	err = comments.Comments[0].WalkReplies(ctx, func(reply Comment, depth int) error {
+		texts = append(texts, fmt.Sprintf("%d %s", depth, reply.Text))
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal([]string{"1 reply", "2 reply to reply"}, texts)
+
+	annotation := NewAnnotation("file:content", "annotation")
+	annotation.EntityID = "go-annotation-1"
+	annotation.Origin = "go"
+	annotation, err = file.CreateAnnotation(ctx, annotation)
+	assert.Nil(err)
+
+	annotations, err := file.FetchAnnotations(ctx, "file:content")
+	assert.Nil(err)
+	assert.Equal(1, len(annotations))
+
+	external, err := file.FetchAnnotationByEntityID(ctx, "go-annotation-1")
+	assert.Nil(err)
+	assert.Equal(annotation.ID, external.ID)
+
+	assert.Nil(file.DeleteAnnotationByEntityID(ctx, "go-annotation-1"))
+	assert.Nil(file.DeleteComment(ctx, comment.ID))
+
+	_, err = file.FetchComment(ctx, comment.ID)
+	assert.True(IsNotFound(err))
+
+	assert.Nil(nuxeoClient.DeleteDocument(ctx, file))
+}
+
+func TestCommentThread(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/id/c1/@comment":
+			if r.URL.Query().Get("currentPageIndex") == "0" {
+				w.Write([]byte(`{"entries":[{"id":"r1","text":"r1","numberOfReplies":1}],"isNextPageAvailable":true}`))
+			} else {
+				w.Write([]byte(`{"entries":[{"id":"r2","text":"r2"}],"isNextPageAvailable":false}`))
+			}
+		case "/api/v1/id/r1/@comment":
+			w.Write([]byte(`{"entries":[{"id":"r11","text":"r11"}]}`))
+		case "/api/v1/id/doc/@annotation/external/ext 1":
+			w.Write([]byte(`{"entity-type":"annotation","id":"a1","xpath":"file:content","entityId":"ext 1"}`))
+		case "/api/v1/path/default-domain/file/@comment":
+			if r.Method == http.MethodPost {
+				w.Write([]byte(`{"entity-type":"comment","id":"c2","text":"by path"}`))
+			} else {
+				w.Write([]byte(`{"entries":[{"id":"c2","text":"by path"}]}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build().(*nuxeoClient)
+
+	var walked []string
+	err := Comment{ID: "c1", nuxeoClient: nuxeoClient}.WalkReplies(ctx, func(reply Comment, depth int) error {
+		walked = append(walked, fmt.Sprintf("%d %s", depth, reply.ID))
+		return nil
+	})
+
+	assert.Nil(err)
+	assert.Equal([]string{"1 r1", "2 r11", "1 r2"}, walked)
+
+	annotation, err := Document{UID: "doc", nuxeoClient: nuxeoClient}.FetchAnnotationByEntityID(ctx, "ext 1")
+
+	assert.Nil(err)
+	assert.Equal("a1", annotation.ID)
+	assert.Equal("file:content", annotation.XPath)
+	assert.Equal("ext 1", annotation.EntityID)
+
+	// Documents known by path only are reached through their path
+	doc := Document{Path: "/default-domain/file", nuxeoClient: nuxeoClient}
+
+	comment, err := doc.CreateComment(ctx, NewComment("by path"))
+
+	assert.Nil(err)
+	assert.Equal("c2", comment.ID)
+
+	comments, err := doc.FetchComments(ctx, 10, 0)
+
+	assert.Nil(err)
+	assert.Equal(1, len(comments.Comments))
+}
+
+func TestAudit(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	file, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("File", "audit_file_with_go"))
+	assert.Nil(err)
+
+	file.Set("dc:title", "audited")
+	file, err = nuxeoClient.UpdateDocument(ctx, file)
+	assert.Nil(err)
+
+	// The audit is written asynchronously
+	time.Sleep(2 * time.Second)
+
+	it := file.Audit(AuditOptions{EventIDs: []string{"documentCreated"}, Principals: []string{"Administrator"}})
+	count := 0
+	for it.Next(ctx) {
+		assert.Equal(file.UID, it.Entry().DocUUID)
+		count++
+	}
+	assert.Nil(it.Err())
+	assert.Equal(1, count)
+
+	it = nuxeoClient.AuditQuery(AuditOptions{EventIDs: []string{"documentModified"}, Start: time.Now().Add(-time.Hour), PageSize: 10})
+	assert.True(it.Next(ctx))
+	assert.Nil(it.Err())
+
+	assert.Nil(nuxeoClient.DeleteDocument(ctx, file))
+}
+
+func TestWorkflow(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	file, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("File", "workflow_file_with_go"))
+	assert.Nil(err)
+
+	workflow, err := nuxeoClient.StartWorkflow(ctx, file, "SerialDocumentReview", nil)
+	assert.Nil(err)
+	assert.Equal("SerialDocumentReview", workflow.WorkflowModelName)
+	assert.Equal(file.UID, workflow.AttachedDocumentIDs[0].ID)
+
+	workflows, err := nuxeoClient.ListWorkflows(ctx, file)
+	assert.Nil(err)
+	assert.Equal(1, len(workflows))
+
+	tasks, err := nuxeoClient.ListTasks(ctx, TaskFilter{Document: file})
+	assert.Nil(err)
+	assert.Equal(1, len(tasks))
+	assert.Equal(workflow.ID, tasks[0].WorkflowInstanceID)
+
+	tasks, err = nuxeoClient.ListTasks(ctx, TaskFilter{UserID: "Administrator", WorkflowInstanceID: workflow.ID})
+	assert.Nil(err)
+	assert.Equal(1, len(tasks))
+
+	_, err = nuxeoClient.DelegateTask(ctx, tasks[0], []string{"user:Administrator"}, "delegated")
+	assert.Nil(err)
+
+	assert.Nil(nuxeoClient.CancelWorkflow(ctx, workflow))
+
+	workflows, err = nuxeoClient.ListWorkflows(ctx, file)
+	assert.Nil(err)
+	assert.Equal(0, len(workflows))
+
+	assert.Nil(nuxeoClient.DeleteDocument(ctx, file))
+}
+
+func TestStartWorkflowByPath(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/path/default-domain/file":
+			w.Write([]byte(`{"entity-type":"document","uid":"doc","path":"/default-domain/file"}`))
+		case "/api/v1/id/doc/@workflow":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			assert.Equal([]interface{}{"doc"}, body["attachedDocumentIds"])
+			w.Write([]byte(`{"entity-type":"workflow","id":"w1","attachedDocumentIds":[{"id":"doc"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build()
+	doc := Document{Path: "/default-domain/file"}
+
+	// The uid of documents known by path is resolved first
+	workflow, err := nuxeoClient.StartWorkflow(ctx, doc, "SerialDocumentReview", nil)
+
+	assert.Nil(err)
+	assert.Equal("w1", workflow.ID)
+
+	_, err = nuxeoClient.StartWorkflow(ctx, Document{UID: "doc"}, "SerialDocumentReview", map[string]interface{}{"invalid": make(chan int)})
+
+	var marshalErr *json.UnsupportedTypeError
+	assert.True(errors.As(err, &marshalErr))
+}
+
+func TestTaskRequests(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/task/t1/delegate":
+			assert.Equal(http.MethodPut, r.Method)
+			assert.Equal([]string{"user:jdoe", "group:members"}, r.URL.Query()["delegatedActors"])
+			assert.Equal("away", r.URL.Query().Get("comment"))
+		case "/api/v1/task/t1/validate":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			assert.Equal("t1", body["id"])
+			assert.Equal("ok", body["comment"])
+			assert.Equal(map[string]interface{}{"comment": "node variable"}, body["variables"])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"entity-type":"task","id":"t1","targetDocumentIds":[{"id":"doc"}],"actors":[{"id":"user:jdoe"}],
+			"variables":{"comment":"node variable"},"taskInfo":{"taskActions":[{"name":"validate","label":"Validate"}]}}`))
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build()
+	task := Task{ID: "t1"}
+
+	delegated, err := nuxeoClient.DelegateTask(ctx, task, []string{"user:jdoe", "group:members"}, "away")
+
+	assert.Nil(err)
+	assert.Equal([]EntityRef{{ID: "user:jdoe"}}, delegated.Actors)
+	assert.Equal("validate", delegated.TaskInfo.TaskActions[0].Name)
+
+	completed, err := nuxeoClient.CompleteTask(ctx, task, "validate", map[string]interface{}{"comment": "node variable"}, "ok")
+
+	assert.Nil(err)
+	assert.Equal("doc", completed.TargetDocumentIDs[0].ID)
+
+	var refs []EntityRef
+	assert.Nil(json.Unmarshal([]byte(`["doc1",{"id":"doc2"}]`), &refs))
+	assert.Equal([]EntityRef{{ID: "doc1"}, {ID: "doc2"}}, refs)
+}
+
+func TestVersioning(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	newDocument := NewDocument("File", "versioned_file_with_go")
+	newDocument.Properties["dc:title"] = "Version 0.1"
+
+	newDocument, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", newDocument)
+
+	assert.Nil(err)
+
+	newDocument.Properties["dc:title"] = "Version 0.1"
+	updatedDocument, err := nuxeoClient.UpdateDocument(ctx, newDocument, WithVersioning(VersionMinor))
+
+	assert.Nil(err)
+	assert.Equal("0.1", updatedDocument.VersionLabel)
+	assert.False(updatedDocument.IsCheckedOut)
+
+	updatedDocument, err = updatedDocument.CheckOut(ctx)
+
+	assert.Nil(err)
+	assert.True(updatedDocument.IsCheckedOut)
+
+	updatedDocument.Properties["dc:title"] = "Version 1.0"
+	updatedDocument, err = nuxeoClient.UpdateDocument(ctx, updatedDocument)
+
+	assert.Nil(err)
+
+	updatedDocument, err = updatedDocument.CheckIn(ctx, VersionMajor, "first major")
+
+	assert.Nil(err)
+	assert.Equal("1.0", updatedDocument.VersionLabel)
+
+	versions, err := updatedDocument.Versions(ctx)
+
+	assert.Nil(err)
+	assert.Equal(2, len(versions.Documents))
+
+	version, err := updatedDocument.FetchVersion(ctx, "0.1")
+
+	assert.Nil(err)
+	assert.True(version.IsVersion)
+
+	_, err = updatedDocument.FetchVersion(ctx, "42.0")
+	assert.True(IsNotFound(err))
+
+	restoredDocument, err := updatedDocument.RestoreVersion(ctx, version)
+
+	assert.Nil(err)
+	assert.Equal("Version 0.1", restoredDocument.Properties["dc:title"])
+
+	err = nuxeoClient.DeleteDocument(ctx, restoredDocument)
+	assert.Nil(err)
+}
+
+func TestLock(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	newDocument, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("File", "locked_file_with_go"))
+
+	assert.Nil(err)
+	assert.False(newDocument.IsLocked())
+
+	lockedDocument, err := newDocument.Lock(ctx)
+
+	assert.Nil(err)
+	assert.Equal("Administrator", lockedDocument.LockOwner)
+	assert.NotNil(lockedDocument.LockCreated)
+
+	status, err := newDocument.FetchLockStatus(ctx)
+
+	assert.Nil(err)
+	assert.True(status.IsLocked())
+
+	unlockedDocument, err := newDocument.Unlock(ctx)
+
+	assert.Nil(err)
+	assert.False(unlockedDocument.IsLocked())
+
+	failure := errors.New("job failed")
+	err = nuxeoClient.WithLock(ctx, newDocument, func(locked Document) error {
+		assert.True(locked.IsLocked())
+		return failure
+	})
+
+	assert.Equal(failure, err)
+
+	status, err = newDocument.FetchLockStatus(ctx)
+
+	assert.Nil(err)
+	assert.False(status.IsLocked())
+
+	err = nuxeoClient.DeleteDocument(ctx, newDocument)
+	assert.Nil(err)
+}
+
+func TestWithLockUnlockTimeout(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/Document.Unlock") {
+			// The server stalls until the end of the test
+			<-stalled
+			return
+		}
+		w.Write([]byte(`{"entity-type":"document","uid":"1","lockOwner":"Administrator"}`))
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	defer func(timeout time.Duration) { unlockTimeout = timeout }(unlockTimeout)
+	unlockTimeout = 100 * time.Millisecond
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build()
+
+	start := time.Now()
+	err := nuxeoClient.WithLock(ctx, Document{UID: "1"}, func(doc Document) error {
+		return nil
+	})
+
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.True(time.Since(start) < 5*time.Second)
+}
+
+func TestPermissions(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	newDocument, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", NewDocument("File", "acl_file_with_go"))
+
+	assert.Nil(err)
+
+	end := time.Now().Add(24 * time.Hour)
+	_, err = newDocument.AddPermission(ctx, Permission{
+		Users:      []string{"members"},
+		Permission: "ReadWrite",
+		End:        &end,
+		Comment:    "temporary access",
+	})
+
+	assert.Nil(err)
+
+	acp, err := newDocument.FetchACP(ctx)
+
+	assert.Nil(err)
+
+	var added *ACE
+	for _, acl := range acp.ACLs {
+		for i, ace := range acl.ACEs {
+			if acl.Name == LocalACL && ace.Username == "members" {
+				added = &acl.ACEs[i]
+			}
+		}
+	}
+
+	assert.NotNil(added)
+	assert.Equal("ReadWrite", added.Permission)
+	assert.True(added.Granted)
+	assert.NotNil(added.End)
+
+	_, err = newDocument.RemovePermission(ctx, added.ID, LocalACL)
+	assert.Nil(err)
+
+	_, err = newDocument.BlockPermissionInheritance(ctx)
+	assert.Nil(err)
+
+	_, err = newDocument.UnblockPermissionInheritance(ctx)
+	assert.Nil(err)
+
+	allowed, err := newDocument.HasPermission(ctx, "Everything")
+
+	assert.Nil(err)
+	assert.True(allowed)
+
+	err = nuxeoClient.DeleteDocument(ctx, newDocument)
+	assert.Nil(err)
+}
+
+func TestContextParameters(t *testing.T) {
+	assert := assert.New(t)
+
+	nuxeoClient := NuxeoClient().Enrichers([]string{"acls", "preview"}).Build().(*nuxeoClient)
+
+	assert.Equal("acls,preview,permissions", nuxeoClient.enrichersHeader("permissions")["enrichers.document"])
+
+	var doc Document
+	err := json.Unmarshal([]byte(`{"uid":"1","contextParameters":{"permissions":["Read","Write"]}}`), &doc)
+
+	assert.Nil(err)
+
+	var permissions []string
+	assert.Nil(doc.ContextParameter("permissions", &permissions))
+	assert.Equal([]string{"Read", "Write"}, permissions)
+	assert.NotNil(doc.ContextParameter("tags", &permissions))
+}
+
+func TestDirtyProperties(t *testing.T) {
+	assert := assert.New(t)
+
+	var doc Document
+	err := json.Unmarshal([]byte(`{"entity-type":"document","uid":"1","changeToken":"3","properties":{"dc:title":"title","dc:description":"description","dc:creator":"Administrator"}}`), &doc)
+
+	assert.Nil(err)
+	assert.False(doc.IsDirty())
+
+	// Unchanged properties are not sent back
+	var body map[string]interface{}
+	data, _ := doc.updateBody()
+	json.Unmarshal(data, &body)
+	assert.Empty(body["properties"])
+
+	doc.Set("dc:title", "new title")
+	doc.Clear("dc:creator")
+	// Direct changes are sent as well
+	doc.Properties["dc:description"] = "new description"
+	doc.Properties["dc:subjects"] = []string{"art"}
+
+	assert.True(doc.IsDirty())
+	assert.Equal("new title", doc.Properties["dc:title"])
+
+	body = nil
+	data, _ = doc.updateBody()
+	json.Unmarshal(data, &body)
+
+	assert.Equal(map[string]interface{}{
+		"dc:title":       "new title",
+		"dc:creator":     nil,
+		"dc:description": "new description",
+		"dc:subjects":    []interface{}{"art"},
+	}, body["properties"])
+	assert.Equal("3", body["changeToken"])
+	assert.Len(doc.Properties, 4)
+
+	// Documents built locally send all their properties
+	doc = NewDocument("File", "file")
+	doc.Properties["dc:title"] = "title"
+	assert.True(doc.IsDirty())
+
+	body = nil
+	data, _ = doc.updateBody()
+	json.Unmarshal(data, &body)
+	assert.Equal(map[string]interface{}{"dc:title": "title"}, body["properties"])
+}
+
+func TestPropertyAccessors(t *testing.T) {
+	assert := assert.New(t)
+
+	var doc Document
+	err := json.Unmarshal([]byte(`{"entity-type":"document","uid":"1","properties":{
+		"dc:title":"title",
+		"dc:created":"2021-03-04T10:11:12.345Z",
+		"dc:subjects":["art","music"],
+		"dc:description":null,
+		"common:size":1234,
+		"file:content":{"name":"pink.jpg","mime-type":"image/jpeg","digest":"abc","length":"1234","data":"http://localhost/blob"},
+		"files:files":[{"file":{"name":"first.txt","mime-type":"text/plain"}}]
+	}}`), &doc)
+
+	assert.Nil(err)
+
+	title, err := doc.GetString("dc:title")
+	assert.Nil(err)
+	assert.Equal("title", title)
+
+	description, err := doc.GetString("dc:description")
+	assert.Nil(err)
+	assert.Equal("", description)
+
+	size, err := doc.GetInt("common:size")
+	assert.Nil(err)
+	assert.Equal(int64(1234), size)
+
+	created, err := doc.GetTime("dc:created")
+	assert.Nil(err)
+	assert.Equal(time.Date(2021, 3, 4, 10, 11, 12, 345000000, time.UTC), created)
+
+	subjects, err := doc.GetStrings("dc:subjects")
+	assert.Nil(err)
+	assert.Equal([]string{"art", "music"}, subjects)
+
+	blob, err := doc.GetBlob("file:content")
+	assert.Nil(err)
+	assert.Equal("pink.jpg", blob.Name)
+	assert.Equal("1234", blob.Length)
+
+	digest, err := doc.GetString("file:content/digest")
+	assert.Nil(err)
+	assert.Equal("abc", digest)
+
+	first, err := doc.GetBlob("files:files/0/file")
+	assert.Nil(err)
+	assert.Equal("first.txt", first.Name)
+
+	_, err = doc.GetString("files:files/1/file")
+	assert.True(errors.Is(err, ErrPropertyNotFound))
+
+	_, err = doc.GetInt("dc:title")
+	assert.NotNil(err)
+
+	assert.Nil(doc.SetBlob("files:files/1/file", BatchBlob{BatchID: "batch", FileIdx: "0"}))
+	assert.Nil(doc.SetString("my:complex/items/0/label", "label"))
+	assert.Nil(doc.SetTime("dc:expired", created))
+	assert.NotNil(doc.Set("dc:title/sub", "value"))
+
+	label, err := doc.GetString("my:complex/items/0/label")
+	assert.Nil(err)
+	assert.Equal("label", label)
+
+	expired, err := doc.GetTime("dc:expired")
+	assert.Nil(err)
+	assert.True(created.Equal(expired))
+
+	files, _ := doc.Get("files:files")
+	assert.Len(files, 2)
+
+	var body map[string]map[string]interface{}
+	data, _ := doc.updateBody()
+	json.Unmarshal(data, &body)
+
+	assert.Len(body["properties"], 3)
+	assert.Contains(body["properties"], "files:files")
+}
+
+func TestStringListProperties(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := NewDocument("File", "file")
+
+	// Lists of strings can be changed item by item, however they have been set
+	assert.Nil(doc.SetStrings("dc:subjects", []string{"art", "music"}))
+	assert.Nil(doc.Set("dc:subjects/0", "sciences"))
+	doc.Properties["dc:contributors"] = []string{"Administrator"}
+	assert.Nil(doc.Set("dc:contributors/1", "Guest"))
+
+	item, err := doc.Get("dc:subjects/1")
+	assert.Nil(err)
+	assert.Equal("music", item)
+
+	subjects, err := doc.GetStrings("dc:subjects")
+	assert.Nil(err)
+	assert.Equal([]string{"sciences", "music"}, subjects)
+
+	contributors, err := doc.GetStrings("dc:contributors")
+	assert.Nil(err)
+	assert.Equal([]string{"Administrator", "Guest"}, contributors)
+}
+
+type attachment struct {
+	File BlobProperty `nuxeo:"file"`
+}
+
+type mappedFile struct {
+	UID         string       `nuxeo:"ecm:uuid"`
+	Type        string       `nuxeo:"ecm:primaryType"`
+	Name        string       `nuxeo:"ecm:name"`
+	Title       string       `nuxeo:"dc:title"`
+	Subjects    []string     `nuxeo:"dc:subjects"`
+	Created     time.Time    `nuxeo:"dc:created"`
+	Expired     *time.Time   `nuxeo:"dc:expired,omitempty"`
+	Content     BlobProperty `nuxeo:"file:content"`
+	Attachments []attachment `nuxeo:"files:files"`
+	Ignored     string
+}
+
+func TestStructMapping(t *testing.T) {
+	assert := assert.New(t)
+
+	var records Documents
+	err := json.Unmarshal([]byte(`{"entries":[{"entity-type":"document","uid":"1","type":"File","name":"file","properties":{
+		"dc:title":"title",
+		"dc:created":"2021-03-04T10:11:12.345Z",
+		"dc:expired":null,
+		"dc:subjects":["art","music"],
+		"file:content":{"name":"pink.jpg","mime-type":"image/jpeg","length":"1234"},
+		"files:files":[{"file":{"name":"first.txt"}}]
+	}}]}`), &records)
+
+	assert.Nil(err)
+
+	var files []mappedFile
+	assert.Nil(records.Unmarshal(&files))
+	assert.Len(files, 1)
+
+	file := files[0]
+	assert.Equal("1", file.UID)
+	assert.Equal("File", file.Type)
+	assert.Equal("title", file.Title)
+	assert.Equal([]string{"art", "music"}, file.Subjects)
+	assert.Equal(time.Date(2021, 3, 4, 10, 11, 12, 345000000, time.UTC), file.Created)
+	assert.Nil(file.Expired)
+	assert.Equal("image/jpeg", file.Content.MimeType)
+	assert.Equal("first.txt", file.Attachments[0].File.Name)
+
+	doc, err := DocumentFrom(mappedFile{Type: "File", Name: "mapped", Title: "mapped", Created: file.Created, Attachments: []attachment{{}}})
+
+	assert.Nil(err)
+	assert.Equal("File", doc.Type)
+	assert.Equal("mapped", doc.Name)
+	assert.True(doc.IsDirty())
+	assert.Equal("mapped", doc.Properties["dc:title"])
+	assert.Equal("2021-03-04T10:11:12.345Z", doc.Properties["dc:created"])
+	assert.NotContains(doc.Properties, "dc:expired")
+	assert.Len(doc.Properties["files:files"], 1)
+
+	assert.NotNil(doc.Unmarshal(file))
+	_, err = DocumentFrom("file")
+	assert.NotNil(err)
 }
 
-func TestRepositoryFetch(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+func TestTagsEnricher(t *testing.T) {
+	assert := assert.New(t)
+
+	var doc Document
+	json.Unmarshal([]byte(`{"uid":"1","contextParameters":{"tags":["art",{"label":"music","username":"Administrator"}]}}`), &doc)
 
-	rootDocument, err := nuxeoClient.FetchDocumentRoot()
+	tags, err := doc.tags()
 
 	assert.Nil(err)
+	assert.Equal([]string{"art", "music"}, tags)
+}
 
-	assert.Equal("/", rootDocument.Path)
+func TestAuditQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("FROM LogEntry log ORDER BY log.eventDate DESC, log.id DESC", auditQuery(AuditOptions{}))
+
+	query := auditQuery(AuditOptions{
+		EventIDs:   []string{"documentCreated", "documentModified"},
+		Principals: []string{"o'neil"},
+		Start:      time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+
+	assert.Equal("FROM LogEntry log WHERE log.eventId IN ('documentCreated', 'documentModified') AND log.principalName IN ('o''neil') AND log.eventDate >= '2021-01-02 03:04:05' ORDER BY log.eventDate DESC, log.id DESC", query)
+}
+
+func TestDocumentAudit(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal("/api/v1/id/doc/@audit", r.URL.Path)
+		assert.Equal([]string{"documentCreated", "documentModified"}, query["eventId"])
+		assert.Equal("2021-01-03", query.Get("startEventDate"))
+		assert.Equal("2", query.Get("pageSize"))
+		if query.Get("currentPageIndex") == "0" {
+			w.Write([]byte(`{"entries":[{"id":3,"eventId":"documentModified","principalName":"Administrator","eventDate":"2021-01-03T10:00:00.000Z"},{"id":2,"eventId":"documentModified"}],"isNextPageAvailable":true}`))
+		} else {
+			w.Write([]byte(`{"entries":[{"id":1,"eventId":"documentCreated"}],"isNextPageAvailable":false}`))
+		}
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build().(*nuxeoClient)
+	doc := Document{UID: "doc", nuxeoClient: nuxeoClient}
+
+	it := doc.Audit(AuditOptions{
+		EventIDs: []string{"documentCreated", "documentModified"},
+		// The day is sent in UTC
+		Start:    time.Date(2021, 1, 2, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60)),
+		PageSize: 2,
+	})
+
+	var ids []int64
+	for it.Next(ctx) {
+		ids = append(ids, it.Entry().ID)
+	}
+
+	assert.Nil(it.Err())
+	assert.Equal([]int64{3, 2, 1}, ids)
+}
+
+func TestUpdateOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	options := newUpdateOptions([]UpdateOption{WithVersioning(VersionMajor)})
+
+	assert.Equal("MAJOR", options.headers["X-Versioning-Option"])
+	assert.Empty(newUpdateOptions(nil).headers)
+}
+
+func TestSpecialCharactersPath(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
 
-	domain, err := nuxeoClient.FetchDocumentByPath("/default-domain")
+	newDocument := NewDocument("File", "go file #1?")
+	newDocument.Properties["dc:title"] = "Go File"
+
+	newDocument, err := nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", newDocument)
 
 	assert.Nil(err)
 
-	assert.Equal("/default-domain", domain.Path)
+	fetchedDocument, err := nuxeoClient.FetchDocumentByPath(ctx, newDocument.Path)
 
-	documents := domain.FetchChildren()
+	assert.Nil(err)
+	assert.Equal(newDocument.UID, fetchedDocument.UID)
 
-	assert.Equal(3, len(documents.Documents))
+	err = nuxeoClient.DeleteDocument(ctx, fetchedDocument)
+	assert.Nil(err)
 }
 
-func TestAsyncFunctions(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+func TestDetachedDocument(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
 
-	c := make(chan document, 1)
+	doc := NewDocument("File", "file")
 
-	go nuxeoClient.AsyncFetchDocumentByPath("/default-domain", c)
+	_, err := doc.FetchChildren(ctx)
+	assert.Equal(ErrNotBound, err)
 
-	select {
-	case rootDocument := <-c:
-		assert.Equal("/default-domain", rootDocument.Path)
-	case <-time.After(1 * time.Second):
-		assert.Fail("Result should have been received already")
-	}
+	_, err = doc.AsyncFetchBlob(ctx, "file:content").Await(ctx)
+	assert.Equal(ErrNotBound, err)
+
+	it := doc.ChildrenIterator(10)
+	assert.False(it.Next(ctx))
+	assert.Equal(ErrNotBound, it.Err())
+
+	_, err = doc.OpenBlob(ctx, "file:content")
+	assert.Equal(ErrNotBound, err)
+
+	_, err = doc.FetchVersion(ctx, "1.0")
+	assert.Equal(ErrNotBound, err)
+
+	_, err = doc.Lock(ctx)
+	assert.Equal(ErrNotBound, err)
+
+	_, err = doc.FetchACP(ctx)
+	assert.Equal(ErrNotBound, err)
+
+	_, err = doc.Tags(ctx)
+	assert.Equal(ErrNotBound, err)
+
+	_, err = doc.FetchComments(ctx, 10, 0)
+	assert.Equal(ErrNotBound, err)
+
+	_, err = NewComment("comment").Reply(ctx, NewComment("reply"))
+	assert.Equal(ErrNotBound, err)
+
+	audit := doc.Audit(AuditOptions{})
+	assert.False(audit.Next(ctx))
+	assert.Equal(ErrNotBound, audit.Err())
 }
 
-func TestRepositoryCRUD(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+func TestEscapePath(t *testing.T) {
+	assert := assert.New(t)
 
-	workspaces, err := nuxeoClient.FetchDocumentByPath("/nuxeo")
+	assert.Equal("/", escapePath("/"))
+	assert.Equal("/default-domain/my%20file%20%231%3F", escapePath("/default-domain/my file #1?"))
+}
 
-	if err != nil {
-		assert.Fail("call error")
-	}
+func TestNotFoundError(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
 
-	properties := map[string]interface{}{
-		"dc:title": "New Document",
-	}
+	_, err := nuxeoClient.FetchDocumentByPath(ctx, "/default-domain/does-not-exist")
 
-	newDocument := document{
-		EntityType: "document",
-		Type:       "File",
-		Name:       "new_file_with_go",
-		Properties: properties,
-	}
+	assert.True(IsNotFound(err))
+
+	var nuxeoErr *NuxeoError
+	assert.True(errors.As(err, &nuxeoErr))
+	assert.Equal(404, nuxeoErr.Status)
+	assert.Contains(nuxeoErr.URL, "/api/v1/path/default-domain/does-not-exist")
+}
+
+func TestNuxeoErrorSentinels(t *testing.T) {
+	assert := assert.New(t)
+
+	var err error = &NuxeoError{Status: 409, Message: "conflict"}
+
+	assert.True(IsConflict(err))
+	assert.True(errors.Is(fmt.Errorf("wrapped: %w", err), ErrConflict))
+	assert.False(IsNotFound(err))
+	assert.False(IsUnauthorized(err))
+	assert.False(IsForbidden(err))
+}
+
+func TestInvalidJSONResponse(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>maintenance</html>"))
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build()
+
+	_, err := nuxeoClient.FetchDocumentByPath(ctx, "/")
 
-	newDocument, err = nuxeoClient.CreateDocument(workspaces.Path, newDocument)
+	var syntaxErr *json.SyntaxError
+	assert.True(errors.As(err, &syntaxErr))
+	assert.True(strings.HasPrefix(err.Error(), "nuxeo: invalid JSON response"))
+}
+
+func TestModelConstructors(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := NewDocument("File", "file")
+	assert.Equal("document", doc.EntityType)
+	assert.Equal("File", doc.Type)
+	assert.NotNil(doc.Properties)
+
+	newUser := NewUser("go")
+	assert.Equal("user", newUser.EntityType)
+	assert.Equal("go", newUser.Properties["username"])
+
+	entry := NewDirectoryEntry("continent", map[string]interface{}{"id": "go"})
+	assert.Equal("directoryEntry", entry.EntityType)
+	assert.Equal("continent", entry.DirectoryName)
+
+	assert.Equal("go", NewGroup("go").Name)
+}
+
+func TestRepositoryQuery(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	resultSet, err := nuxeoClient.Query(ctx, "SELECT * FROM Domain")
 
 	assert.Nil(err)
 
-	assert.NotNil(newDocument.UID)
-	assert.Equal("/nuxeo/new_file_with_go", newDocument.Path)
-	assert.Equal("New Document", newDocument.Properties["dc:title"])
+	assert.Equal(1, len(resultSet.Documents))
+}
+func TestQueryBuilder(t *testing.T) {
+	assert := assert.New(t)
 
-	newDocument.Properties["dc:title"] = "Document Updated"
-	updatedDocument, err := nuxeoClient.UpdateDocument(newDocument)
+	query, err := NewQueryBuilder().From("File", "Note").
+		Where("dc:title", "=", `it's a \ test`).
+		And("dc:subjects", "IN", []string{"art", "sciences"}).
+		And("dc:created", ">=", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)).
+		StartsWith("/default-domain").
+		IsNotVersion().
+		NotTrashed().
+		OrderBy("dc:title", Descending).
+		Build()
 
 	assert.Nil(err)
+	assert.Equal(`SELECT * FROM File, Note WHERE dc:title = 'it\'s a \\ test' AND dc:subjects IN ('art', 'sciences') AND dc:created >= TIMESTAMP '2021-01-02 03:04:05.000+00:00' AND ecm:path STARTSWITH '/default-domain' AND ecm:isVersion = 0 AND ecm:isTrashed = 0 ORDER BY dc:title DESC`, query)
 
-	assert.Equal("Document Updated", updatedDocument.Properties["dc:title"])
+	_, err = NewQueryBuilder().Where("dc:title = 'x' OR 1", "=", "y").Build()
+	assert.NotNil(err)
+
+	_, err = NewQueryBuilder().Where("dc:title", "; DROP", "y").Build()
+	assert.NotNil(err)
+
+	_, err = NewQueryBuilder().Where("dc:title", "=", struct{}{}).Build()
+	assert.NotNil(err)
+
+	// IN and NOT IN take a non empty list, the other operators a single value
+	_, err = NewQueryBuilder().Where("dc:subjects", "IN", []string{}).Build()
+	assert.NotNil(err)
+
+	_, err = NewQueryBuilder().Where("dc:subjects", "NOT IN", "art").Build()
+	assert.NotNil(err)
+
+	_, err = NewQueryBuilder().Where("dc:title", "=", []string{"a"}).Build()
+	assert.NotNil(err)
+
+	query, err = NewQueryBuilder().Where("file:content/length", ">", uint(3)).And("uid:minor_version", "IN", []uint16{0, 1}).Build()
 
-	err = nuxeoClient.DeleteDocument(updatedDocument)
 	assert.Nil(err)
+	assert.Equal(`SELECT * FROM Document WHERE file:content/length > 3 AND uid:minor_version IN (0, 1)`, query)
 
-	updatedDocument, err = nuxeoClient.FetchDocumentByPath(updatedDocument.Path)
-	if err == nil {
-		assert.Fail("This document should not be found")
+	query, err = NewQueryBuilder().From("File").Trashed().Build()
+
+	assert.Nil(err)
+	assert.Equal(`SELECT * FROM File WHERE ecm:isTrashed = 1`, query)
+}
+
+func TestQueryBuilderExecute(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	resultSet, err := nuxeoClient.QueryBuilder().From("Domain").Where("ecm:name", "=", "default-domain").Execute(ctx)
+
+	assert.Nil(err)
+	assert.Equal(1, len(resultSet.Documents))
+}
+
+func TestQueryIterator(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	resultSet, err := nuxeoClient.Query(ctx, "SELECT * FROM Document")
+
+	assert.Nil(err)
+
+	it := nuxeoClient.QueryIterator("SELECT * FROM Document", 2)
+
+	count := 0
+	for it.Next(ctx) {
+		assert.NotEmpty(it.Document().UID)
+		count++
 	}
+
+	assert.Nil(it.Err())
+	assert.Equal(resultSet.ResultsCount, count)
 }
 
-func TestRepositoryQuery(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+func TestChildrenIterator(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
 
-	resultSet, err := nuxeoClient.Query("SELECT * FROM Domain")
+	domain, err := nuxeoClient.FetchDocumentByPath(ctx, "/default-domain")
 
 	assert.Nil(err)
 
-	assert.Equal(1, len(resultSet.Documents))
+	it := domain.ChildrenIterator(1)
+
+	count := 0
+	for it.Next(ctx) {
+		count++
+	}
+
+	assert.Nil(it.Err())
+	assert.Equal(3, count)
+}
+
+func TestQueryIteratorPaging(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var fetched []int
+	fetch := func(ctx context.Context, pageSize int, currentPageIndex int) (Documents, error) {
+		fetched = append(fetched, currentPageIndex)
+		if currentPageIndex == 3 {
+			return Documents{}, errors.New("page should not be fetched")
+		}
+		page := Documents{IsNextPageAvailable: currentPageIndex < 2}
+		for i := 0; i < pageSize; i++ {
+			page.Documents = append(page.Documents, Document{UID: fmt.Sprintf("%d-%d", currentPageIndex, i)})
+		}
+		return page, nil
+	}
+
+	it := newQueryIterator(2, fetch)
+
+	var uids []string
+	for it.Next(ctx) {
+		uids = append(uids, it.Document().UID)
+	}
+
+	assert.Nil(it.Err())
+	assert.Equal([]string{"0-0", "0-1", "1-0", "1-1", "2-0", "2-1"}, uids)
+	assert.Equal([]int{0, 1, 2}, fetched)
+}
+
+func TestQueryIteratorBusySlots(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index := r.URL.Query().Get("currentPageIndex")
+		fmt.Fprintf(w, `{"entity-type":"documents","entries":[{"uid":"%s"}],"isNextPageAvailable":%t}`, index, index != "2")
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).AsyncConcurrency(1).Build().(*nuxeoClient)
+
+	// An unrelated future holds the only slot
+	nuxeoClient.slots <- struct{}{}
+	defer func() { <-nuxeoClient.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	it := nuxeoClient.QueryIterator("SELECT * FROM Document", 1)
+
+	var uids []string
+	for it.Next(ctx) {
+		uids = append(uids, it.Document().UID)
+	}
+
+	assert.Nil(it.Err())
+	assert.Equal([]string{"0", "1", "2"}, uids)
 }
+
 func TestRepositoryDirectory(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+	assert, nuxeoClient, ctx := initTest(t)
 
-	directorySet, err := nuxeoClient.GetDirectory("continent")
+	entries, err := nuxeoClient.GetDirectory(ctx, "continent")
 
 	assert.Nil(err)
 
-	assert.Equal(7, len(directorySet.Entries))
+	assert.Equal(7, len(entries.Entries))
 
 	properties := make(map[string]interface{})
 	properties["id"] = "go"
@@ -172,35 +1680,35 @@ func TestRepositoryDirectory(t *testing.T) {
 	properties["ordering"] = "10"
 	properties["label"] = "Go"
 
-	newDir := directory{
+	newDir := DirectoryEntry{
 		EntityType:    "directoryEntry",
 		DirectoryName: "continent",
 		Properties:    properties,
 	}
 
-	returnedDir, err := nuxeoClient.CreateDirectory("continent", newDir)
+	returnedDir, err := nuxeoClient.CreateDirectory(ctx, "continent", newDir)
 
 	assert.Nil(err)
 	assert.NotEmpty(returnedDir.ID)
 
-	errDelete := nuxeoClient.DeleteDirectory("continent", "go")
+	errDelete := nuxeoClient.DeleteDirectory(ctx, "continent", "go")
 	assert.Nil(errDelete)
 }
 
 func TestAutomation(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+	assert, nuxeoClient, ctx := initTest(t)
 
 	params := make(map[string]string)
 
 	params["value"] = "/"
 
-	doc, err := nuxeoClient.Automation().Operation("Repository.GetDocument").Parameters(params).DocExecute()
+	doc, err := nuxeoClient.Automation().Operation("Repository.GetDocument").Parameters(params).DocExecute(ctx)
 
 	assert.Nil(err)
 	assert.Equal("/", doc.Path)
 
 	params["query"] = "SELECT * FROM Document"
-	records, err := nuxeoClient.Automation().Operation("Repository.Query").Parameters(params).DocListExecute()
+	records, err := nuxeoClient.Automation().Operation("Repository.Query").Parameters(params).DocListExecute(ctx)
 
 	assert.Nil(err)
 	assert.NotEmpty(records.Documents)
@@ -211,48 +1719,315 @@ func TestAutomation(t *testing.T) {
 
 	image, _ := ioutil.ReadFile("pink.jpg")
 
-	blob, blobError := nuxeoClient.Automation().Operation("Blob.AttachOnDocument").Parameters(params).Blob("pink.jpg", image).BlobExecute()
+	blob, blobError := nuxeoClient.Automation().Operation("Blob.AttachOnDocument").Parameters(params).Blob("pink.jpg", image).BlobExecute(ctx)
+
+	assert.Nil(blobError)
+	assert.Equal(1025580, len(blob))
+
+	imageFile, err := os.Open("pink.jpg")
+
+	assert.Nil(err)
+	defer imageFile.Close()
+
+	blob, blobError = nuxeoClient.Automation().Operation("Blob.AttachOnDocument").Parameters(params).BlobStream("pink.jpg", "image/jpeg", imageFile).BlobExecute(ctx)
 
 	assert.Nil(blobError)
 	assert.Equal(1025580, len(blob))
 }
 
+func TestStreamMultipart(t *testing.T) {
+	assert := assert.New(t)
+
+	body, contentType := streamMultipart([]byte(`{"params":{}}`), blobPart{name: "my \"blob\".txt", contentType: "text/plain", reader: strings.NewReader("content")})
+	defer body.Close()
+
+	_, params, err := mime.ParseMediaType(contentType)
+
+	assert.Nil(err)
+
+	reader := multipart.NewReader(body, params["boundary"])
+
+	part, err := reader.NextPart()
+
+	assert.Nil(err)
+	assert.Equal("operation_body", part.FormName())
+	assert.Equal("application/json", part.Header.Get("Content-Type"))
+
+	part, err = reader.NextPart()
+
+	assert.Nil(err)
+	assert.Equal(`my "blob".txt`, part.FileName())
+	data, _ := ioutil.ReadAll(part)
+	assert.Equal("content", string(data))
+
+	_, err = reader.NextPart()
+	assert.Equal(io.EOF, err)
+}
+
+func TestBlobXPathEscaping(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		w.Write([]byte("blob"))
+	}))
+	defer server.Close()
+
+	doc := Document{UID: "1", nuxeoClient: NuxeoClient().URL(server.URL).Debug(DEBUG).Build().(*nuxeoClient)}
+
+	blob, err := doc.OpenBlob(ctx, "files:files/%zz#?/file")
+	assert.Nil(err)
+	blob.Close()
+
+	_, err = doc.FetchBlob(ctx, "files:files/%zz#?/file")
+	assert.Nil(err)
+
+	assert.Equal([]string{"/api/v1/id/1/@blob/files:files/%25zz%23%3F/file", "/api/v1/id/1/@blob/files:files/%25zz%23%3F/file"}, paths)
+
+	// The request cannot be sent at all, resty returns no response
+	doc.nuxeoClient = NuxeoClient().URL("http://[::1").Debug(DEBUG).Build().(*nuxeoClient)
+	_, err = doc.OpenBlob(ctx, "file:content")
+	assert.NotNil(err)
+}
+
+func TestBlobInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	header := http.Header{}
+	header.Set("Content-Type", "image/jpeg")
+	header.Set("Content-Disposition", `attachment; filename*=UTF-8''pink%20image.jpg; filename="pink image.jpg"`)
+	header.Set("ETag", `"0ba8d6a4d3b81b5b6c2c8b0d9f1c4f0e"`)
+
+	info := newBlobInfo(&resty.Response{RawResponse: &http.Response{Header: header, ContentLength: 1025580}})
+
+	assert.Equal("pink image.jpg", info.Filename)
+	assert.Equal("image/jpeg", info.ContentType)
+	assert.Equal(int64(1025580), info.Length)
+	assert.Equal("0ba8d6a4d3b81b5b6c2c8b0d9f1c4f0e", info.Digest)
+}
+
 func TestFetchBlob(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+	assert, nuxeoClient, ctx := initTest(t)
 
-	file, err := nuxeoClient.FetchDocumentByPath("/default-domain/workspaces/workspace/file")
+	file, err := nuxeoClient.FetchDocumentByPath(ctx, "/default-domain/workspaces/workspace/file")
 
 	assert.Nil(err)
 
-	blob, blobError := file.FetchBlob("file:content")
+	blob, blobError := file.FetchBlob(ctx, "file:content")
 
 	assert.Nil(blobError)
 	assert.Equal(1025580, len(blob))
 }
 
-func TestAsyncFetchBlob(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+func TestStreamBlob(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	file, err := nuxeoClient.FetchDocumentByPath(ctx, "/default-domain/workspaces/workspace/file")
+
+	assert.Nil(err)
+
+	var buffer bytes.Buffer
+	info, err := file.FetchBlobTo(ctx, "file:content", &buffer)
+
+	assert.Nil(err)
+	assert.Equal(1025580, buffer.Len())
+	assert.Equal("pink.jpg", info.Filename)
+	assert.Equal("image/jpeg", info.ContentType)
+
+	blob, err := file.OpenBlob(ctx, "file:content")
+
+	assert.Nil(err)
+	defer blob.Close()
+
+	n, err := io.Copy(ioutil.Discard, blob)
+
+	assert.Nil(err)
+	assert.Equal(int64(1025580), n)
+
+	_, err = file.OpenBlob(ctx, "file:missing")
+	assert.NotNil(err)
+}
+
+func TestBatchUpload(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	batch, err := nuxeoClient.BatchUpload(ctx)
+
+	assert.Nil(err)
+	assert.NotEmpty(batch.BatchID)
+
+	image, err := os.Open("pink.jpg")
+
+	assert.Nil(err)
+	defer image.Close()
+
+	stat, _ := image.Stat()
+
+	file, err := batch.Upload(ctx, 0, "pink.jpg", "image/jpeg", image, stat.Size())
+
+	assert.Nil(err)
+	assert.Equal("pink.jpg", file.Name)
+
+	file, err = batch.UploadChunked(ctx, 1, "pink.jpg", "image/jpeg", image, stat.Size(), 300000)
+
+	assert.Nil(err)
+	assert.Equal(4, file.ChunkCount)
+	assert.Equal(4, len(file.UploadedChunkIDs))
 
-	file, err := nuxeoClient.FetchDocumentByPath("/default-domain/workspaces/workspace/file")
+	// Nothing is sent again when resuming a complete upload
+	file, err = nuxeoClient.Batch(batch.BatchID).UploadChunked(ctx, 1, "pink.jpg", "image/jpeg", image, stat.Size(), 300000)
 
 	assert.Nil(err)
+	assert.Equal(4, len(file.UploadedChunkIDs))
 
-	c := make(chan []byte, 1)
+	files, err := batch.Files(ctx)
 
-	go file.AsyncFetchBlob("file:content", c)
+	assert.Nil(err)
+	assert.Equal(2, len(files))
+
+	newDocument := NewDocument("File", "batch_file_with_go")
+	newDocument.Properties["file:content"] = batch.Blob(0)
+
+	newDocument, err = nuxeoClient.CreateDocument(ctx, "/default-domain/workspaces", newDocument)
+
+	assert.Nil(err)
+
+	blob, err := newDocument.FetchBlob(ctx, "file:content")
+
+	assert.Nil(err)
+	assert.Equal(1025580, len(blob))
 
-	select {
-	case blob := <-c:
-		assert.Equal(1025580, len(blob))
-	case <-time.After(10 * time.Second):
-		assert.Fail("Result should have been received already")
+	params := map[string]string{
+		"document": newDocument.Path,
+		"xpath":    "file:content",
 	}
+
+	_, err = nuxeoClient.Automation().Operation("Blob.AttachOnDocument").Parameters(params).BatchInput(batch, 1).BlobExecute(ctx)
+
+	assert.Nil(err)
+
+	err = nuxeoClient.DeleteDocument(ctx, newDocument)
+	assert.Nil(err)
+
+	err = batch.Delete(ctx)
+	assert.Nil(err)
+}
+
+func TestBatchBlob(t *testing.T) {
+	assert := assert.New(t)
+
+	batch := &Batch{BatchID: "batchId-42"}
+
+	data, err := json.Marshal(batch.Blob(1))
+
+	assert.Nil(err)
+	assert.JSONEq(`{"upload-batch":"batchId-42","upload-fileId":"1"}`, string(data))
+}
+
+func TestBatchEscaping(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var paths, names []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		names = append(names, r.Header.Get("X-File-Name"))
+		w.Write([]byte(`{"name":"a+b.txt"}`))
+	}))
+	defer server.Close()
+
+	nuxeoClient := NuxeoClient().URL(server.URL).Debug(DEBUG).Build()
+	batch := nuxeoClient.Batch("batch/42")
+
+	_, err := batch.Upload(ctx, 0, "a+b c.txt", "text/plain", strings.NewReader("ab"), 2)
+	assert.Nil(err)
+
+	_, err = nuxeoClient.Automation().Operation("Blob.AttachOnDocument").BatchInput(batch, 0).Execute(ctx)
+	assert.Nil(err)
+
+	// Nuxeo decodes the file name with URLDecoder, + stands for a space
+	assert.Equal("a%2Bb+c.txt", names[0])
+	assert.Equal([]string{"/api/v1/upload/batch%2F42/0", "/api/v1/upload/batch%2F42/0/execute/Blob.AttachOnDocument"}, paths)
+}
+
+func TestUploadChunkedRetry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var posts int32
+	var chunks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if len(chunks) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"name":"file.txt","uploadedChunkIds":[0,1],"chunkCount":2}`))
+			return
+		}
+		// The first attempt of each chunk is rejected
+		if atomic.AddInt32(&posts, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		chunks = append(chunks, string(data))
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+
+	batch := NuxeoClient().URL(server.URL).Debug(DEBUG).Retry(policy).Build().Batch("batchId-42")
+
+	file, err := batch.UploadChunked(ctx, 0, "file.txt", "text/plain", strings.NewReader("abcde"), 5, 3)
+
+	assert.Nil(err)
+	assert.Equal(2, len(file.UploadedChunkIDs))
+	assert.Equal(int32(4), atomic.LoadInt32(&posts))
+	assert.Equal([]string{"abc", "de"}, chunks)
+}
+
+func TestEmptyBatchFiles(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	files, err := NuxeoClient().URL(server.URL).Debug(DEBUG).Build().Batch("batchId-42").Files(ctx)
+
+	assert.Nil(err)
+	assert.NotNil(files)
+	assert.Empty(files)
+}
+
+func TestAsyncFetchBlob(t *testing.T) {
+	assert, nuxeoClient, ctx := initTest(t)
+
+	file, err := nuxeoClient.FetchDocumentByPath(ctx, "/default-domain/workspaces/workspace/file")
+
+	assert.Nil(err)
+
+	awaitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	blob, err := file.AsyncFetchBlob(ctx, "file:content").Await(awaitCtx)
+
+	assert.Nil(err)
+	assert.Equal(1025580, len(blob))
 }
 
 func TestUserGroup(t *testing.T) {
-	assert, nuxeoClient := initTest(t)
+	assert, nuxeoClient, ctx := initTest(t)
 
-	returnedUser, err := nuxeoClient.GetUser("Administrator")
+	returnedUser, err := nuxeoClient.GetUser(ctx, "Administrator")
 
 	assert.Nil(err)
 	assert.Contains(returnedUser.Properties["groups"], "administrators")
@@ -265,17 +2040,17 @@ func TestUserGroup(t *testing.T) {
 	properties["email"] = "go@nuxeo.com"
 	properties["username"] = "go"
 
-	newUser := user{
+	newUser := User{
 		Username:   "go",
 		EntityType: "user",
 		Properties: properties,
 	}
 
-	returnedUser, err = nuxeoClient.CreateUser(newUser)
+	returnedUser, err = nuxeoClient.CreateUser(ctx, newUser)
 
 	assert.Nil(err)
 
-	err = nuxeoClient.DeleteUser("go")
+	err = nuxeoClient.DeleteUser(ctx, "go")
 
 	assert.Nil(err)
 }
@@ -286,11 +2061,12 @@ func TestUserGroup(t *testing.T) {
 // goarch: amd64
 // 8423910 ns/op	   14573 B/op	     234 allocs/op
 func BenchmarkF(b *testing.B) {
+	ctx := context.Background()
 	nuxeoClient := NuxeoClient().URL("http://localhost:8080/nuxeo").Username("Administrator").Password("Administrator").Debug(DEBUG).Schemas([]string{"*"}).Build()
 
-	nuxeoClient.Login()
+	nuxeoClient.Login(ctx)
 
 	for i := 0; i < b.N; i++ {
-		nuxeoClient.FetchDocumentRoot()
+		nuxeoClient.FetchDocumentRoot(ctx)
 	}
 }
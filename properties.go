@@ -0,0 +1,305 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPropertyNotFound is returned by the property getters when the xpath does not exist
+var ErrPropertyNotFound = errors.New("nuxeo: property not found")
+
+// DateLayout is the layout of the date properties sent to the server
+const DateLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// BlobProperty is a blob property of a document, such as file:content
+type BlobProperty struct {
+	Name            string `json:"name"`
+	MimeType        string `json:"mime-type"`
+	Encoding        string `json:"encoding"`
+	DigestAlgorithm string `json:"digestAlgorithm"`
+	Digest          string `json:"digest"`
+	Length          string `json:"length"`
+	Data            string `json:"data"`
+}
+
+// Get returns the value at xpath, such as "dc:title" or "files:files/0/file"
+func (doc Document) Get(xpath string) (interface{}, error) {
+	segments := strings.Split(xpath, "/")
+
+	value, ok := doc.Properties[segments[0]]
+
+	for _, segment := range segments[1:] {
+		if !ok {
+			break
+		}
+		switch container := value.(type) {
+		case map[string]interface{}:
+			value, ok = container[segment]
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			ok = err == nil && idx >= 0 && idx < len(container)
+			if ok {
+				value = container[idx]
+			}
+		case []string:
+			idx, err := strconv.Atoi(segment)
+			ok = err == nil && idx >= 0 && idx < len(container)
+			if ok {
+				value = container[idx]
+			}
+		default:
+			ok = false
+		}
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPropertyNotFound, xpath)
+	}
+
+	return value, nil
+}
+
+// GetString returns the string at xpath, empty when null
+func (doc Document) GetString(xpath string) (string, error) {
+	value, err := doc.Get(xpath)
+
+	if err != nil || value == nil {
+		return "", err
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", typeError(xpath, "a string", value)
+	}
+
+	return s, nil
+}
+
+// GetInt returns the integer or long at xpath, 0 when null
+func (doc Document) GetInt(xpath string) (int64, error) {
+	value, err := doc.Get(xpath)
+
+	if err != nil || value == nil {
+		return 0, err
+	}
+
+	switch n := value.(type) {
+	case float64:
+		if n == math.Trunc(n) {
+			return int64(n), nil
+		}
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case string:
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+
+	return 0, typeError(xpath, "an integer", value)
+}
+
+// GetTime returns the date at xpath, the zero time when null
+func (doc Document) GetTime(xpath string) (time.Time, error) {
+	value, err := doc.Get(xpath)
+
+	if err != nil || value == nil {
+		return time.Time{}, err
+	}
+
+	t, ok := parseTime(value)
+	if !ok {
+		return time.Time{}, typeError(xpath, "a date", value)
+	}
+
+	return t, nil
+}
+
+// parseTime reads a date property, as sent by the server or set with SetTime
+func parseTime(value interface{}) (time.Time, bool) {
+	switch t := value.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// GetStrings returns the list of strings at xpath, such as "dc:subjects"
+func (doc Document) GetStrings(xpath string) ([]string, error) {
+	value, err := doc.Get(xpath)
+
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	switch list := value.(type) {
+	case []string:
+		return list, nil
+	case []interface{}:
+		strs := make([]string, len(list))
+		for i, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, typeError(xpath, "a list of strings", value)
+			}
+			strs[i] = s
+		}
+		return strs, nil
+	}
+
+	return nil, typeError(xpath, "a list of strings", value)
+}
+
+// GetBlob returns the blob at xpath, such as "file:content" or "files:files/0/file"
+func (doc Document) GetBlob(xpath string) (BlobProperty, error) {
+	value, err := doc.GetComplex(xpath)
+
+	if err != nil || value == nil {
+		return BlobProperty{}, err
+	}
+
+	var blob BlobProperty
+	data, _ := json.Marshal(value)
+	err = json.Unmarshal(data, &blob)
+
+	return blob, err
+}
+
+// GetComplex returns the complex property at xpath, nil when null
+func (doc Document) GetComplex(xpath string) (map[string]interface{}, error) {
+	value, err := doc.Get(xpath)
+
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	complexValue, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, typeError(xpath, "a complex property", value)
+	}
+
+	return complexValue, nil
+}
+
+// SetString sets the string at xpath
+func (doc *Document) SetString(xpath string, value string) error {
+	return doc.Set(xpath, value)
+}
+
+// SetInt sets the integer or long at xpath
+func (doc *Document) SetInt(xpath string, value int64) error {
+	return doc.Set(xpath, value)
+}
+
+// SetTime sets the date at xpath
+func (doc *Document) SetTime(xpath string, value time.Time) error {
+	return doc.Set(xpath, value.Format(DateLayout))
+}
+
+// SetStrings sets the list of strings at xpath
+func (doc *Document) SetStrings(xpath string, value []string) error {
+	// Stored as decoded from JSON, so that items can be set by index afterwards
+	list := make([]interface{}, len(value))
+	for i, item := range value {
+		list[i] = item
+	}
+	return doc.Set(xpath, list)
+}
+
+// SetBlob references an uploaded batch file at xpath
+func (doc *Document) SetBlob(xpath string, value BatchBlob) error {
+	return doc.Set(xpath, value)
+}
+
+// SetComplex sets the complex property at xpath
+func (doc *Document) SetComplex(xpath string, value map[string]interface{}) error {
+	return doc.Set(xpath, value)
+}
+
+// setPath sets value at segments below container, creating the missing maps and lists,
+// and returns the container to store in place of the given one
+func setPath(container interface{}, segments []string, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+
+	segment := segments[0]
+
+	if idx, err := strconv.Atoi(segment); err == nil {
+		if idx < 0 {
+			return nil, fmt.Errorf("negative index %d", idx)
+		}
+		var list []interface{}
+		switch c := container.(type) {
+		case nil:
+		case []interface{}:
+			list = c
+		case []string:
+			// Assigned directly to Properties
+			list = make([]interface{}, len(c))
+			for i, item := range c {
+				list[i] = item
+			}
+		default:
+			return nil, fmt.Errorf("%s is not a list", segment)
+		}
+		for len(list) <= idx {
+			list = append(list, nil)
+		}
+		item, err := setPath(list[idx], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[idx] = item
+		return list, nil
+	}
+
+	var complexValue map[string]interface{}
+	switch c := container.(type) {
+	case nil:
+		complexValue = make(map[string]interface{})
+	case map[string]interface{}:
+		complexValue = c
+	default:
+		return nil, fmt.Errorf("%s cannot be set on a %T", segment, container)
+	}
+	item, err := setPath(complexValue[segment], segments[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	complexValue[segment] = item
+	return complexValue, nil
+}
+
+func typeError(xpath string, expected string, value interface{}) error {
+	return fmt.Errorf("nuxeo: property %s is not %s but %T", xpath, expected, value)
+}
@@ -0,0 +1,328 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Ascending sort order for OrderBy
+	Ascending = "ASC"
+	// Descending sort order for OrderBy
+	Descending = "DESC"
+)
+
+// nxqlTimestamp is the layout of NXQL TIMESTAMP literals
+const nxqlTimestamp = "2006-01-02 15:04:05.000-07:00"
+
+var (
+	nxqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_:/.*\-]*$`)
+	nxqlOperators  = map[string]bool{
+		"=": true, "<>": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+		"LIKE": true, "ILIKE": true, "NOT LIKE": true, "NOT ILIKE": true,
+		"IN": true, "NOT IN": true, "STARTSWITH": true,
+		"IS NULL": true, "IS NOT NULL": true,
+	}
+)
+
+type queryBuilder struct {
+	columns          []string
+	docTypes         []string
+	conditions       []string
+	orderBy          []string
+	pageSize         int
+	currentPageIndex int
+	err              error
+	nuxeoClient      *nuxeoClient
+}
+
+// QueryBuilder builds NXQL queries with correctly quoted and escaped values
+type QueryBuilder interface {
+	Select(columns ...string) QueryBuilder
+	From(docTypes ...string) QueryBuilder
+	Where(property string, operator string, value interface{}) QueryBuilder
+	And(property string, operator string, value interface{}) QueryBuilder
+	StartsWith(path string) QueryBuilder
+	FullText(text string) QueryBuilder
+	IsNotVersion() QueryBuilder
+	NotTrashed() QueryBuilder
+	Trashed() QueryBuilder
+	OrderBy(property string, order string) QueryBuilder
+	PageSize(pageSize int) QueryBuilder
+	CurrentPageIndex(currentPageIndex int) QueryBuilder
+	Build() (string, error)
+	Execute(ctx context.Context) (Documents, error)
+	Iterator() *QueryIterator
+}
+
+// NewQueryBuilder returns a query builder not bound to any client, to build NXQL strings only
+func NewQueryBuilder() QueryBuilder {
+	return &queryBuilder{}
+}
+
+// Select sets the selected columns, "*" by default
+func (qb *queryBuilder) Select(columns ...string) QueryBuilder {
+	for _, column := range columns {
+		if column != "*" {
+			qb.checkIdentifier(column)
+		}
+	}
+	qb.columns = columns
+	return qb
+}
+
+// From sets the queried document types, "Document" by default
+func (qb *queryBuilder) From(docTypes ...string) QueryBuilder {
+	for _, docType := range docTypes {
+		qb.checkIdentifier(docType)
+	}
+	qb.docTypes = docTypes
+	return qb
+}
+
+// Where adds a condition, conditions are joined with AND
+func (qb *queryBuilder) Where(property string, operator string, value interface{}) QueryBuilder {
+	qb.checkIdentifier(property)
+
+	operator = strings.ToUpper(strings.TrimSpace(operator))
+	if !nxqlOperators[operator] {
+		qb.fail(fmt.Errorf("nuxeo: unsupported operator %q", operator))
+		return qb
+	}
+
+	if operator == "IS NULL" || operator == "IS NOT NULL" {
+		qb.conditions = append(qb.conditions, property+" "+operator)
+		return qb
+	}
+
+	var literal string
+	var err error
+	if operator == "IN" || operator == "NOT IN" {
+		literal, err = nxqlList(operator, value)
+	} else {
+		literal, err = nxqlLiteral(value)
+	}
+	if err != nil {
+		qb.fail(err)
+		return qb
+	}
+
+	qb.conditions = append(qb.conditions, property+" "+operator+" "+literal)
+	return qb
+}
+
+// And is an alias of Where, for readability
+func (qb *queryBuilder) And(property string, operator string, value interface{}) QueryBuilder {
+	return qb.Where(property, operator, value)
+}
+
+// StartsWith restricts the query to the documents under path
+func (qb *queryBuilder) StartsWith(path string) QueryBuilder {
+	return qb.Where("ecm:path", "STARTSWITH", path)
+}
+
+// FullText restricts the query to the documents matching text
+func (qb *queryBuilder) FullText(text string) QueryBuilder {
+	return qb.Where("ecm:fulltext", "=", text)
+}
+
+// IsNotVersion excludes versions
+func (qb *queryBuilder) IsNotVersion() QueryBuilder {
+	return qb.Where("ecm:isVersion", "=", 0)
+}
+
+// NotTrashed excludes trashed documents
+func (qb *queryBuilder) NotTrashed() QueryBuilder {
+	return qb.Where("ecm:isTrashed", "=", 0)
+}
+
+// Trashed restricts the results to trashed documents
+func (qb *queryBuilder) Trashed() QueryBuilder {
+	return qb.Where("ecm:isTrashed", "=", 1)
+}
+
+// OrderBy adds a sort clause, order being Ascending or Descending
+func (qb *queryBuilder) OrderBy(property string, order string) QueryBuilder {
+	qb.checkIdentifier(property)
+
+	order = strings.ToUpper(order)
+	if order != Ascending && order != Descending {
+		qb.fail(fmt.Errorf("nuxeo: unsupported sort order %q", order))
+		return qb
+	}
+
+	qb.orderBy = append(qb.orderBy, property+" "+order)
+	return qb
+}
+
+// PageSize sets the page size used by Execute and Iterator
+func (qb *queryBuilder) PageSize(pageSize int) QueryBuilder {
+	qb.pageSize = pageSize
+	return qb
+}
+
+// CurrentPageIndex sets the page returned by Execute
+func (qb *queryBuilder) CurrentPageIndex(currentPageIndex int) QueryBuilder {
+	qb.currentPageIndex = currentPageIndex
+	return qb
+}
+
+// Build returns the NXQL query, or the first error met while building it
+func (qb *queryBuilder) Build() (string, error) {
+	if qb.err != nil {
+		return "", qb.err
+	}
+
+	columns := qb.columns
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+
+	docTypes := qb.docTypes
+	if len(docTypes) == 0 {
+		docTypes = []string{"Document"}
+	}
+
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + strings.Join(docTypes, ", ")
+
+	if len(qb.conditions) > 0 {
+		query += " WHERE " + strings.Join(qb.conditions, " AND ")
+	}
+
+	if len(qb.orderBy) > 0 {
+		query += " ORDER BY " + strings.Join(qb.orderBy, ", ")
+	}
+
+	return query, nil
+}
+
+// Execute runs the query through QueryWithParams
+func (qb *queryBuilder) Execute(ctx context.Context) (Documents, error) {
+	if qb.nuxeoClient == nil {
+		return Documents{}, errors.New("nuxeo: query builder is not bound to a client")
+	}
+
+	query, err := qb.Build()
+	if err != nil {
+		return Documents{}, err
+	}
+
+	return qb.nuxeoClient.QueryWithParams(ctx, query, qb.pageSize, qb.currentPageIndex, 0, 0, "", "", "")
+}
+
+// Iterator walks all the results of the query, PageSize at a time
+func (qb *queryBuilder) Iterator() *QueryIterator {
+	query, err := qb.Build()
+	if err == nil && qb.nuxeoClient == nil {
+		err = errors.New("nuxeo: query builder is not bound to a client")
+	}
+	if err != nil {
+		return &QueryIterator{pager: pager{err: err}}
+	}
+
+	return qb.nuxeoClient.QueryIterator(query, qb.pageSize)
+}
+
+func (qb *queryBuilder) checkIdentifier(identifier string) {
+	if !nxqlIdentifier.MatchString(identifier) {
+		qb.fail(fmt.Errorf("nuxeo: invalid identifier %q", identifier))
+	}
+}
+
+func (qb *queryBuilder) fail(err error) {
+	if qb.err == nil {
+		qb.err = err
+	}
+}
+
+// nxqlLiteral formats value as an NXQL literal
+func nxqlLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return nxqlString(v), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case time.Time:
+		return "TIMESTAMP " + nxqlString(v.Format(nxqlTimestamp)), nil
+	}
+
+	return "", fmt.Errorf("nuxeo: unsupported value type %T", value)
+}
+
+// nxqlList formats value, a non empty slice or array, as the NXQL list expected by IN and NOT IN
+func nxqlList(operator string, value interface{}) (string, error) {
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return "", fmt.Errorf("nuxeo: %s expects a list, not %T", operator, value)
+	}
+	if list.Len() == 0 {
+		return "", fmt.Errorf("nuxeo: %s expects a non empty list", operator)
+	}
+
+	literals := make([]string, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		literal, err := nxqlLiteral(list.Index(i).Interface())
+		if err != nil {
+			return "", err
+		}
+		literals[i] = literal
+	}
+	return "(" + strings.Join(literals, ", ") + ")", nil
+}
+
+// nxqlString quotes s, escaping backslashes and single quotes
+func nxqlString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
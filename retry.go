@@ -0,0 +1,216 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// DefaultMaxRetryAfter is the longest Retry-After delay waited for if none has been set
+	DefaultMaxRetryAfter = time.Minute
+)
+
+// RetryPolicy configures how failed requests are retried. Waits between attempts
+// grow exponentially from InitialBackoff up to MaxBackoff, with jitter, unless the
+// server sends a Retry-After header: its delay is then honored as is, even above
+// MaxBackoff, up to MaxRetryAfter.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, retries are disabled below 2
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxRetryAfter is the longest Retry-After delay waited for (DefaultMaxRetryAfter if <= 0),
+	// the response asking for a longer one is returned without retrying
+	MaxRetryAfter time.Duration
+	// StatusCodes are the response statuses to retry, connection errors are always retried
+	StatusCodes []int
+	// RetryNonIdempotent allows retrying POST and PATCH requests, which may apply them twice
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy retries idempotent requests 3 times on 429, 502, 503, 504 and connection errors
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		MaxRetryAfter:  DefaultMaxRetryAfter,
+		StatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// attemptsKey holds the attempt counter of a request in its context
+type attemptsKey struct{}
+
+// retryableKey marks in its context a request that can be sent again whatever its method
+type retryableKey struct{}
+
+// retryable marks the requests sent with ctx as safe to retry, such as the upload of a batch chunk
+func retryable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryableKey{}, true)
+}
+
+// apply configures the resty client with the policy
+func (policy RetryPolicy) apply(client *resty.Client) {
+	if policy.MaxAttempts < 2 {
+		return
+	}
+
+	client.SetRetryCount(policy.MaxAttempts - 1)
+	// Waits are computed by backoff, resty would otherwise cap the Retry-After delays at its max wait time,
+	// the longer ones being filtered by shouldRetry
+	client.SetRetryWaitTime(0)
+	client.SetRetryMaxWaitTime(time.Duration(math.MaxInt64))
+	client.SetRetryAfter(policy.backoff)
+	client.OnBeforeRequest(countAttempt)
+	client.AddRetryCondition(func(resp *resty.Response, err error) bool {
+		// resty checks the conditions after the last attempt too, its response must be left untouched
+		if attempts(resp) >= policy.MaxAttempts {
+			return false
+		}
+		retry := policy.shouldRetry(resp, err)
+		if retry {
+			// Release the connection of responses that are not parsed, such as streamed blobs
+			if body := resp.RawBody(); body != nil {
+				body.Close()
+			}
+		}
+		return retry
+	})
+}
+
+// countAttempt counts the attempts of the request in its context, the counter being created on the first one
+func countAttempt(client *resty.Client, request *resty.Request) error {
+	counter, ok := request.Context().Value(attemptsKey{}).(*int32)
+	if !ok {
+		counter = new(int32)
+		request.SetContext(context.WithValue(request.Context(), attemptsKey{}, counter))
+	}
+	atomic.AddInt32(counter, 1)
+	return nil
+}
+
+// attempts returns the number of attempts made so far for the request of resp
+func attempts(resp *resty.Response) int {
+	if resp == nil || resp.Request == nil {
+		return 0
+	}
+	counter, ok := resp.Request.Context().Value(attemptsKey{}).(*int32)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt32(counter))
+}
+
+// backoff returns the wait before the next attempt: the Retry-After delay when the server sends one,
+// an exponential backoff with jitter capped at MaxBackoff otherwise
+func (policy RetryPolicy) backoff(client *resty.Client, resp *resty.Response) (time.Duration, error) {
+	if wait := retryAfter(resp); wait > 0 {
+		return wait, nil
+	}
+
+	wait := float64(policy.MaxBackoff)
+	if attempt := attempts(resp); attempt > 0 {
+		wait = math.Min(wait, float64(policy.InitialBackoff)*math.Exp2(float64(attempt-1)))
+	}
+
+	half := int64(wait / 2)
+	if half <= 0 {
+		// resty falls back to its own backoff on 0
+		return time.Nanosecond, nil
+	}
+
+	return time.Duration(half + rand.Int63n(half)), nil
+}
+
+func (policy RetryPolicy) shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+
+	// Streamed bodies are consumed by the first attempt and cannot be sent again
+	if _, ok := resp.Request.Body.(io.Reader); ok {
+		return false
+	}
+
+	retryable, _ := resp.Request.Context().Value(retryableKey{}).(bool)
+	if !policy.RetryNonIdempotent && !retryable && !isIdempotent(resp.Request.Method) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	maxRetryAfter := policy.MaxRetryAfter
+	if maxRetryAfter <= 0 {
+		maxRetryAfter = DefaultMaxRetryAfter
+	}
+	if retryAfter(resp) > maxRetryAfter {
+		return false
+	}
+
+	for _, status := range policy.StatusCodes {
+		if resp.StatusCode() == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryAfter reads the Retry-After header, in seconds or as an http date, 0 when missing
+func retryAfter(resp *resty.Response) time.Duration {
+	value := resp.Header().Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && time.Until(date) > 0 {
+		return time.Until(date)
+	}
+
+	return 0
+}
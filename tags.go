@@ -0,0 +1,95 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Tags fetches the tags of the document with the tags enricher
+func (doc Document) Tags(ctx context.Context) ([]string, error) {
+	if err := doc.bound(); err != nil {
+		return nil, err
+	}
+
+	enriched, err := doc.fetchEnriched(ctx, "tags")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return enriched.tags()
+}
+
+// tags reads the output of the tags enricher, a list of labels or of tag entities depending on the server version
+func (doc Document) tags() ([]string, error) {
+	var entries []json.RawMessage
+
+	if err := doc.ContextParameter("tags", &entries); err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, len(entries))
+	for i, entry := range entries {
+		if err := json.Unmarshal(entry, &tags[i]); err == nil {
+			continue
+		}
+		var tag struct {
+			Label string `json:"label"`
+		}
+		if err := json.Unmarshal(entry, &tag); err != nil {
+			return nil, err
+		}
+		tags[i] = tag.Label
+	}
+
+	return tags, nil
+}
+
+// AddTags tags the document, tags cannot contain commas
+func (doc Document) AddTags(ctx context.Context, tags ...string) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	return doc.tagOperation(ctx, "Services.TagDocument", tags)
+}
+
+// RemoveTags removes the given tags from the document
+func (doc Document) RemoveTags(ctx context.Context, tags ...string) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	return doc.tagOperation(ctx, "Services.UntagDocument", tags)
+}
+
+func (doc Document) tagOperation(ctx context.Context, operation string, tags []string) (Document, error) {
+	params := map[string]string{
+		"tags": strings.Join(tags, ","),
+	}
+
+	return doc.nuxeoClient.Automation().Operation(operation).Input(doc.input()).Parameters(params).DocExecute(ctx)
+}
+
+// FindByTag walks the documents tagged with tag, pageSize at a time
+func (nuxeoClient *nuxeoClient) FindByTag(tag string, pageSize int) *QueryIterator {
+	return nuxeoClient.QueryBuilder().Where("ecm:tag", "=", tag).PageSize(pageSize).Iterator()
+}
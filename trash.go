@@ -0,0 +1,38 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+)
+
+// TrashDocument moves doc, and its children, to the trash, unlike DeleteDocument it can be undone
+func (nuxeoClient *nuxeoClient) TrashDocument(ctx context.Context, doc Document) (Document, error) {
+	return nuxeoClient.Automation().Operation("Document.Trash").Input(doc.input()).DocExecute(ctx)
+}
+
+// UntrashDocument restores a trashed document, and its trashed parents
+func (nuxeoClient *nuxeoClient) UntrashDocument(ctx context.Context, doc Document) (Document, error) {
+	return nuxeoClient.Automation().Operation("Document.Untrash").Input(doc.input()).DocExecute(ctx)
+}
+
+// EmptyTrash permanently deletes the trashed children of parent
+func (nuxeoClient *nuxeoClient) EmptyTrash(ctx context.Context, parent Document) error {
+	_, err := nuxeoClient.Automation().Operation("Document.EmptyTrash").Input(parent.input()).Execute(ctx)
+	return err
+}
@@ -18,11 +18,13 @@
 package nuxeoclient
 
 import (
+	"context"
 	"encoding/json"
+	"net/url"
 )
 
 // User structure
-type user struct {
+type User struct {
 	Username        string                 `json:"id"`
 	EntityType      string                 `json:"entity-type"`
 	IsAdministrator bool                   `json:"isAdministrator"`
@@ -30,7 +32,8 @@ type user struct {
 	IsAnonymous     bool                   `json:"isAnonymous"`
 }
 
-type userLogged struct {
+// CurrentUser is the user returned by Login
+type CurrentUser struct {
 	Username        string   `json:"username"`
 	EntityType      string   `json:"entity-type"`
 	IsAdministrator bool     `json:"isAdministrator"`
@@ -38,40 +41,61 @@ type userLogged struct {
 }
 
 // Group structure
-type group struct {
-	Name string `json:"name"`
+type Group struct {
+	EntityType   string   `json:"entity-type"`
+	Name         string   `json:"groupname"`
+	Label        string   `json:"grouplabel"`
+	MemberUsers  []string `json:"memberUsers"`
+	MemberGroups []string `json:"memberGroups"`
 }
 
-func (nuxeoClient *nuxeoClient) GetUser(username string) (user, error) {
-	uri := nuxeoClient.url + "/api/v1/user/" + username
+// NewUser creates a user, ready to be passed to CreateUser
+func NewUser(username string) User {
+	return User{
+		Username:   username,
+		EntityType: "user",
+		Properties: map[string]interface{}{
+			"username": username,
+		},
+	}
+}
+
+// NewGroup creates a group with the given name
+func NewGroup(name string) Group {
+	return Group{
+		EntityType: "group",
+		Name:       name,
+	}
+}
 
-	resp, err := nuxeoClient.client.R().EnableTrace().Get(uri)
+func (nuxeoClient *nuxeoClient) GetUser(ctx context.Context, username string) (User, error) {
+	uri := nuxeoClient.url + "/api/v1/user/" + url.PathEscape(username)
 
-	var returnedUser user
+	resp, err := nuxeoClient.request(ctx).Get(uri)
+
+	var returnedUser User
 	err = HandleResponse(err, resp, &returnedUser)
 
 	return returnedUser, err
 }
 
-func (nuxeoClient *nuxeoClient) CreateUser(newUser user) (user, error) {
+func (nuxeoClient *nuxeoClient) CreateUser(ctx context.Context, newUser User) (User, error) {
 	uri := nuxeoClient.url + "/api/v1/user"
 
 	body, err := json.Marshal(newUser)
 
-	resp, err := nuxeoClient.client.R().EnableTrace().SetBody(string(body[:])).Post(uri)
+	resp, err := nuxeoClient.request(ctx).SetBody(string(body[:])).Post(uri)
 
-	var returnedUser user
+	var returnedUser User
 	err = HandleResponse(err, resp, &returnedUser)
 
 	return returnedUser, err
 }
 
-func (nuxeoClient *nuxeoClient) DeleteUser(username string) error {
-	uri := nuxeoClient.url + "/api/v1/user/" + username
-
-	resp, err := nuxeoClient.client.R().EnableTrace().Delete(uri)
+func (nuxeoClient *nuxeoClient) DeleteUser(ctx context.Context, username string) error {
+	uri := nuxeoClient.url + "/api/v1/user/" + url.PathEscape(username)
 
-	_ = resp
+	resp, err := nuxeoClient.request(ctx).Delete(uri)
 
-	return err
+	return HandleResponse(err, resp, nil)
 }
@@ -19,7 +19,9 @@ package nuxeoclient
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 	log "github.com/sirupsen/logrus"
@@ -28,13 +30,52 @@ import (
 // HandleResponse handle all responses
 func HandleResponse(err error, resp *resty.Response, q interface{}) error {
 
+	err = checkResponse(err, resp)
+
+	if err != nil {
+		return err
+	}
+
+	data := resp.Body()
+
+	// Nothing to decode, such as the listing of an empty batch
+	if resp.StatusCode() == 204 || len(data) == 0 {
+		return nil
+	}
+
+	if q == nil {
+		// The response is still checked
+		q = new(json.RawMessage)
+	}
+
+	if err := json.Unmarshal(data, q); err != nil {
+		return fmt.Errorf("nuxeo: invalid JSON response: %w", err)
+	}
+
+	return nil
+}
+
+// checkResponse traces the response and turns error statuses into a NuxeoError
+func checkResponse(err error, resp *resty.Response) error {
+
 	if err != nil {
 		return err
 	}
 
+	traceResponse(resp)
+
+	if resp.IsError() {
+		return newNuxeoError(resp, resp.Body())
+	}
+
+	return nil
+}
+
+// traceResponse logs the response and request trace info in debug
+func traceResponse(resp *resty.Response) {
+
 	// Explore response object
 	log.Debug("Response Info:")
-	log.Debug("  Error      :", err)
 	log.Debug("  Status Code:", resp.StatusCode())
 	log.Debug("  Status     :", resp.Status())
 	log.Debug("  Proto      :", resp.Proto())
@@ -56,26 +97,13 @@ func HandleResponse(err error, resp *resty.Response, q interface{}) error {
 	log.Debug("  IsConnReused  :", ti.IsConnReused)
 	log.Debug("  IsConnWasIdle :", ti.IsConnWasIdle)
 	log.Debug("  ConnIdleTime  :", ti.ConnIdleTime)
+}
 
-	data := resp.Body()
-
-	if resp.StatusCode() != 204 && !json.Valid(data) {
-		return errors.New("Json response is not valid")
-	}
-
-	if resp.StatusCode() == 404 {
-		return errors.New("Cannot find resources")
-	}
-
-	if q == nil {
-		return nil
-	}
-
-	jsonErr := json.Unmarshal(data, q)
-
-	if jsonErr != nil {
-		return jsonErr
+// escapePath escapes each segment of a repository path
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
 	}
-
-	return nil
+	return strings.Join(segments, "/")
 }
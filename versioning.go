@@ -0,0 +1,142 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// VersioningOption tells the server which version to create when a document is saved
+type VersioningOption string
+
+const (
+	// VersionNone saves the document without creating a version
+	VersionNone VersioningOption = "NONE"
+	// VersionMinor creates a minor version (0.1 -> 0.2)
+	VersionMinor VersioningOption = "MINOR"
+	// VersionMajor creates a major version (0.1 -> 1.0)
+	VersionMajor VersioningOption = "MAJOR"
+)
+
+// UpdateOption customizes an UpdateDocument call
+type UpdateOption func(*updateOptions)
+
+type updateOptions struct {
+	headers map[string]string
+}
+
+// WithVersioning creates a version of the document when it is updated
+func WithVersioning(option VersioningOption) UpdateOption {
+	return func(options *updateOptions) {
+		options.headers["X-Versioning-Option"] = string(option)
+	}
+}
+
+func newUpdateOptions(options []UpdateOption) *updateOptions {
+	updateOptions := &updateOptions{
+		headers: make(map[string]string),
+	}
+	for _, option := range options {
+		option(updateOptions)
+	}
+	return updateOptions
+}
+
+// Versions lists the versions of the document
+func (doc Document) Versions(ctx context.Context) (Documents, error) {
+	if err := doc.bound(); err != nil {
+		return Documents{}, err
+	}
+
+	url := doc.nuxeoClient.documentURL(doc) + "/@versions"
+
+	resp, err := doc.nuxeoClient.request(ctx).Get(url)
+
+	var records Documents
+	err = HandleResponse(err, resp, &records)
+
+	records.attach(doc.nuxeoClient)
+
+	return records, err
+}
+
+// FetchVersion returns the version of the document with the given label, such as "1.0"
+func (doc Document) FetchVersion(ctx context.Context, label string) (Document, error) {
+	versions, err := doc.Versions(ctx)
+
+	if err != nil {
+		return Document{}, err
+	}
+
+	for _, version := range versions.Documents {
+		if version.VersionLabel == label {
+			return version, nil
+		}
+	}
+
+	return Document{}, fmt.Errorf("%w: version %s of %s", ErrNotFound, label, doc.Path)
+}
+
+// CheckIn creates a version of the document, option being VersionMinor or VersionMajor
+func (doc Document) CheckIn(ctx context.Context, option VersioningOption, comment string) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	params := map[string]string{
+		"version": strings.ToLower(string(option)),
+	}
+	if comment != "" {
+		params["comment"] = comment
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.CheckIn").Input(doc.input()).Parameters(params).DocExecute(ctx)
+}
+
+// CheckOut checks the document out so that it can be modified after a check in
+func (doc Document) CheckOut(ctx context.Context) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.CheckOut").Input(doc.input()).DocExecute(ctx)
+}
+
+// RestoreVersion restores the live document to the given version, the restored document is checked out
+func (doc Document) RestoreVersion(ctx context.Context, version Document) (Document, error) {
+	if err := doc.bound(); err != nil {
+		return Document{}, err
+	}
+
+	params := map[string]string{
+		"createVersion": "false",
+		"checkout":      "true",
+	}
+
+	return doc.nuxeoClient.Automation().Operation("Document.RestoreVersion").Input(version.input()).Parameters(params).DocExecute(ctx)
+}
+
+// input references the document as an automation input
+func (doc Document) input() string {
+	if doc.UID != "" {
+		return "doc:" + doc.UID
+	}
+	return "doc:" + doc.Path
+}
@@ -0,0 +1,234 @@
+// (C) Copyright 2021 Nuxeo (http:nuxeo.com) and others.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http:www.apache.orglicensesLICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Contributors:
+// 	Vladimir Pasquier <vpasquier@nuxeo.com>
+
+package nuxeoclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// EntityRef references a document or a user from a workflow or a task
+type EntityRef struct {
+	ID string `json:"id"`
+}
+
+// UnmarshalJSON reads the reference either as an id or as an entity with an id
+func (ref *EntityRef) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &ref.ID); err == nil {
+		return nil
+	}
+
+	type plainRef EntityRef
+	return json.Unmarshal(data, (*plainRef)(ref))
+}
+
+// Workflow is a running instance of a workflow model
+type Workflow struct {
+	EntityType          string                 `json:"entity-type"`
+	ID                  string                 `json:"id"`
+	Name                string                 `json:"name"`
+	Title               string                 `json:"title"`
+	State               string                 `json:"state"`
+	WorkflowModelName   string                 `json:"workflowModelName"`
+	Initiator           string                 `json:"initiator"`
+	AttachedDocumentIDs []EntityRef            `json:"attachedDocumentIds"`
+	Variables           map[string]interface{} `json:"variables"`
+}
+
+// Task is a step of a workflow waiting for its actors
+type Task struct {
+	EntityType         string        `json:"entity-type"`
+	ID                 string        `json:"id"`
+	Name               string        `json:"name"`
+	WorkflowInstanceID string        `json:"workflowInstanceId"`
+	WorkflowModelName  string        `json:"workflowModelName"`
+	State              string        `json:"state"`
+	Directive          string        `json:"directive"`
+	NodeName           string        `json:"nodeName"`
+	Created            *time.Time    `json:"created"`
+	DueDate            *time.Time    `json:"dueDate"`
+	TargetDocumentIDs  []EntityRef   `json:"targetDocumentIds"`
+	Actors             []EntityRef   `json:"actors"`
+	DelegatedActors    []EntityRef   `json:"delegatedActors"`
+	Comments           []TaskComment `json:"comments"`
+	// Variables holds the workflow variables and the variables of the task node
+	Variables map[string]interface{} `json:"variables"`
+	TaskInfo  TaskInfo               `json:"taskInfo"`
+}
+
+// TaskComment is a comment left on a task
+type TaskComment struct {
+	Author string     `json:"author"`
+	Text   string     `json:"text"`
+	Date   *time.Time `json:"date"`
+}
+
+// TaskInfo describes how a task can be completed
+type TaskInfo struct {
+	AllowTaskReassignment bool         `json:"allowTaskReassignment"`
+	TaskActions           []TaskAction `json:"taskActions"`
+}
+
+// TaskAction is a button of the task, its name being the action passed to CompleteTask
+type TaskAction struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// TaskFilter selects the tasks returned by ListTasks, empty fields not filtering
+type TaskFilter struct {
+	// Document restricts the tasks to the ones targeting the document
+	Document           Document
+	UserID             string
+	WorkflowInstanceID string
+	WorkflowModelName  string
+}
+
+// StartWorkflow starts the workflow modelName, such as "SerialDocumentReview", on doc
+func (nuxeoClient *nuxeoClient) StartWorkflow(ctx context.Context, doc Document, modelName string, variables map[string]interface{}) (Workflow, error) {
+	// The workflow is attached by uid
+	if doc.UID == "" {
+		fetched, err := nuxeoClient.FetchDocumentByPath(ctx, doc.Path)
+		if err != nil {
+			return Workflow{}, err
+		}
+		doc = fetched
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"entity-type":         "workflow",
+		"workflowModelName":   modelName,
+		"attachedDocumentIds": []string{doc.UID},
+		"variables":           variables,
+	})
+	if err != nil {
+		return Workflow{}, err
+	}
+
+	resp, err := nuxeoClient.request(ctx).SetBody(string(body[:])).Post(nuxeoClient.documentURL(doc) + "/@workflow")
+
+	var workflow Workflow
+	err = HandleResponse(err, resp, &workflow)
+
+	return workflow, err
+}
+
+// ListWorkflows returns the running workflows of doc
+func (nuxeoClient *nuxeoClient) ListWorkflows(ctx context.Context, doc Document) ([]Workflow, error) {
+	resp, err := nuxeoClient.request(ctx).Get(nuxeoClient.documentURL(doc) + "/@workflow")
+
+	var workflows struct {
+		Workflows []Workflow `json:"entries"`
+	}
+	err = HandleResponse(err, resp, &workflows)
+
+	return workflows.Workflows, err
+}
+
+// CancelWorkflow cancels the workflow and its open tasks
+func (nuxeoClient *nuxeoClient) CancelWorkflow(ctx context.Context, workflow Workflow) error {
+	resp, err := nuxeoClient.request(ctx).Delete(nuxeoClient.url + "/api/v1/workflow/" + url.PathEscape(workflow.ID))
+
+	return HandleResponse(err, resp, nil)
+}
+
+// ListTasks returns the open tasks matching filter
+func (nuxeoClient *nuxeoClient) ListTasks(ctx context.Context, filter TaskFilter) ([]Task, error) {
+	uri := nuxeoClient.url + "/api/v1/task"
+	if filter.Document.UID != "" || filter.Document.Path != "" {
+		uri = nuxeoClient.documentURL(filter.Document) + "/@task"
+	}
+
+	params := map[string]string{}
+	if filter.UserID != "" {
+		params["userId"] = filter.UserID
+	}
+	if filter.WorkflowInstanceID != "" {
+		params["workflowInstanceId"] = filter.WorkflowInstanceID
+	}
+	if filter.WorkflowModelName != "" {
+		params["workflowModelName"] = filter.WorkflowModelName
+	}
+
+	resp, err := nuxeoClient.request(ctx).SetQueryParams(params).Get(uri)
+
+	var tasks struct {
+		Tasks []Task `json:"entries"`
+	}
+	err = HandleResponse(err, resp, &tasks)
+
+	return tasks.Tasks, err
+}
+
+// DelegateTask lets actors complete the task on behalf of its current actors
+func (nuxeoClient *nuxeoClient) DelegateTask(ctx context.Context, task Task, actors []string, comment string) (Task, error) {
+	request := nuxeoClient.request(ctx).SetQueryParam("comment", comment)
+	for _, actor := range actors {
+		request.QueryParam.Add("delegatedActors", actor)
+	}
+
+	return nuxeoClient.taskRequest(request, nuxeoClient.taskURL(task)+"/delegate")
+}
+
+// ReassignTask replaces the actors of the task
+func (nuxeoClient *nuxeoClient) ReassignTask(ctx context.Context, task Task, actors []string, comment string) (Task, error) {
+	request := nuxeoClient.request(ctx).SetQueryParam("comment", comment)
+	for _, actor := range actors {
+		request.QueryParam.Add("actors", actor)
+	}
+
+	return nuxeoClient.taskRequest(request, nuxeoClient.taskURL(task)+"/reassign")
+}
+
+// CompleteTask completes the task with one of its TaskInfo actions, such as "validate" or "reject",
+// setting the given workflow and node variables
+func (nuxeoClient *nuxeoClient) CompleteTask(ctx context.Context, task Task, action string, variables map[string]interface{}, comment string) (Task, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"entity-type": "task",
+		"id":          task.ID,
+		"comment":     comment,
+		"variables":   variables,
+	})
+	if err != nil {
+		return Task{}, err
+	}
+
+	request := nuxeoClient.request(ctx).SetBody(string(body[:]))
+
+	return nuxeoClient.taskRequest(request, nuxeoClient.taskURL(task)+"/"+url.PathEscape(action))
+}
+
+// taskURL returns the rest api url of the task
+func (nuxeoClient *nuxeoClient) taskURL(task Task) string {
+	return nuxeoClient.url + "/api/v1/task/" + url.PathEscape(task.ID)
+}
+
+// taskRequest sends a task update and reads the resulting task
+func (nuxeoClient *nuxeoClient) taskRequest(request *resty.Request, uri string) (Task, error) {
+	resp, err := request.Put(uri)
+
+	var task Task
+	err = HandleResponse(err, resp, &task)
+
+	return task, err
+}